@@ -0,0 +1,510 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ashtishad/golift/internal/accesslog"
+	"github.com/ashtishad/golift/internal/common"
+	"github.com/ashtishad/golift/internal/domain"
+	"github.com/ashtishad/golift/internal/metrics"
+	"github.com/ashtishad/golift/internal/requestid"
+	"github.com/ashtishad/golift/internal/tracing"
+	"github.com/ashtishad/golift/internal/transport"
+)
+
+// listenerShutdownTimeout bounds how long a listener removed by a reload waits for in-flight requests.
+const listenerShutdownTimeout = 30 * time.Second
+
+// balancer runs the pools, listeners and admin API described by a common.Config.
+// The running configuration is published as an immutable state, so requests and admin calls
+// never lock, and a reload replaces it as a whole once every change has been prepared.
+type balancer struct {
+	state   atomic.Pointer[balancerState]
+	ready   atomic.Bool // Set once listening, cleared when shutting down.
+	l       *slog.Logger
+	metrics *metrics.Registry
+
+	// tracer creates a span per proxied request, nil if tracing is disabled. Its configuration is fixed at startup.
+	tracer   *tracing.Tracer
+	exporter *tracing.Exporter
+
+	// accessFormat renders the access log, which is opened by start if configured. It is fixed at startup.
+	accessFormat accesslog.Format
+	accessLog    *accesslog.Logger
+
+	// requestID configures the id assigned to every request received by a listener or the admin API. It is fixed at startup.
+	requestID common.RequestIDConfig
+
+	// logLevel is the level of the process logger, read and changed via the admin API and by reloads.
+	logLevel *slog.LevelVar
+
+	// listen opens the listening sockets, net.Listen unless sockets are inherited on upgrade.
+	listen func(network, addr string) (net.Listener, error)
+
+	mux       sync.Mutex // Serializes start, reloads and stop, guards the fields below.
+	ctx       context.Context
+	listeners map[string]*http.Server // Load balancer listeners keyed by address.
+	admin     *http.Server
+	stopping  bool // Set by stop, reloads are rejected from then on.
+}
+
+// balancerState is the running configuration and the pools built from it, it is never modified.
+type balancerState struct {
+	conf  *common.Config
+	pools map[string]*pool
+	// routes maps every listener address to the proxy handler of its pool.
+	routes map[string]http.Handler
+}
+
+// pool is a named server pool together with the workers and proxy handler serving it.
+type pool struct {
+	conf            common.PoolConfig
+	serverPool      domain.ServerPooler
+	healthChecker   *domain.HealthChecker
+	outlierDetector *domain.OutlierDetector
+	metrics         *metrics.PoolMetrics
+	tracer          *tracing.Tracer
+	handler         http.HandlerFunc
+}
+
+// newBalancer creates the pools of conf and adds their backends, without probing or listening yet.
+// Errors name the offending field, e.g. "pools[0].strategy: unknown strategy". level is the level of l,
+// changed via the admin API and by reloads.
+func newBalancer(conf *common.Config, level *slog.LevelVar, l *slog.Logger) (*balancer, error) {
+	registry := metrics.NewRegistry()
+
+	var (
+		exporter *tracing.Exporter
+		tracer   *tracing.Tracer
+	)
+
+	if conf.Tracing.Endpoint != "" {
+		exporter = tracing.NewExporter(conf.Tracing.Endpoint, conf.Tracing.ServiceName, l)
+		tracer = tracing.NewTracer(exporter, conf.Tracing.SampleRatio)
+	}
+
+	pools := make(map[string]*pool, len(conf.Pools))
+
+	var errs []error
+
+	accessFormat, err := accesslog.NewFormat(conf.AccessLog.Format, conf.AccessLog.Template)
+	if err != nil {
+		field := "accessLog.format"
+		if conf.AccessLog.Format == "template" {
+			field = "accessLog.template"
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", field, err))
+	}
+
+	for i, pc := range conf.Pools {
+		p, err := newPool(pc, registry.Pool(pc.Name), tracer, l.With("pool", pc.Name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pools[%d]%w", i, err))
+			continue
+		}
+
+		pools[pc.Name] = p
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	b := &balancer{
+		l:        l,
+		metrics:  registry,
+		tracer:   tracer,
+		exporter: exporter,
+
+		accessFormat: accessFormat,
+		requestID:    conf.RequestID,
+		logLevel:     level,
+		listen:       net.Listen,
+		listeners:    make(map[string]*http.Server),
+	}
+
+	b.state.Store(newBalancerState(conf, pools))
+
+	return b, nil
+}
+
+func newBalancerState(conf *common.Config, pools map[string]*pool) *balancerState {
+	routes := make(map[string]http.Handler, len(conf.Listeners))
+	for _, lc := range conf.Listeners {
+		routes[lc.Address] = pools[lc.Pool].handler
+	}
+
+	return &balancerState{conf: conf, pools: pools, routes: routes}
+}
+
+// newPool creates the server pool described by pc, recording its traffic in pm and tracing requests with tracer.
+// Errors are prefixed with the path of the field below pc.
+func newPool(pc common.PoolConfig, pm *metrics.PoolMetrics, tracer *tracing.Tracer, l *slog.Logger) (*pool, error) {
+	strategy, err := domain.NewStrategy(pc.Strategy.Name, pc.Strategy.Options)
+	if err != nil {
+		return nil, fmt.Errorf(".strategy: %w", err)
+	}
+
+	serverPool := domain.NewServerPool(strategy, len(pc.Backends), l, domain.WithStrategyName(pc.Strategy.Name))
+
+	for i, bc := range pc.Backends {
+		srv, err := newServer(bc, pc.HealthCheck, l)
+		if err != nil {
+			return nil, fmt.Errorf(".backends[%d].url: %w", i, err)
+		}
+
+		if appErr := serverPool.AddServer(context.Background(), srv); appErr != nil {
+			return nil, fmt.Errorf(".backends[%d].url: %q: %w", i, bc.URL, appErr)
+		}
+	}
+
+	serverPool.Subscribe(pm)
+
+	p := &pool{
+		conf:          pc,
+		serverPool:    serverPool,
+		healthChecker: newHealthChecker(serverPool, pc.HealthCheck, pm, l),
+		metrics:       pm,
+		tracer:        tracer,
+	}
+	p.setOutlierDetector(newOutlierDetector(serverPool, pc.OutlierDetection, l), l)
+
+	return p, nil
+}
+
+// newServer creates the backend described by bc with the health thresholds of its pool, logging to l.
+func newServer(bc common.BackendConfig, hc common.HealthCheckConfig, l *slog.Logger) (domain.Server, error) {
+	return domain.NewServer(bc.URL,
+		domain.WithWeight(bc.Weight),
+		domain.WithHealthThresholds(hc.Rise, hc.Fall, hc.HoldDown.Duration),
+		domain.WithLogger(l))
+}
+
+// newHealthChecker creates a checker probing the backends of serverPool as configured by hc, recording results in pm.
+func newHealthChecker(serverPool domain.ServerPooler, hc common.HealthCheckConfig, pm *metrics.PoolMetrics, l *slog.Logger) *domain.HealthChecker {
+	return domain.NewHealthChecker(serverPool, domain.HealthCheckConfig{
+		Path:             hc.Path,
+		Interval:         hc.Interval.Duration,
+		Timeout:          hc.Timeout.Duration,
+		ExpectedStatuses: hc.ExpectedStatuses,
+		ExpectedBody:     hc.ExpectedBody,
+	}, l, domain.WithHealthCheckObserver(pm))
+}
+
+// newOutlierDetector creates a detector ejecting backends of serverPool whose proxied responses fail too often.
+func newOutlierDetector(serverPool domain.ServerPooler, od common.OutlierDetectionConfig, l *slog.Logger) *domain.OutlierDetector {
+	return domain.NewOutlierDetector(serverPool, domain.OutlierDetectionConfig{
+		Interval:           od.Interval.Duration,
+		MinRequests:        od.MinRequests,
+		ErrorRateThreshold: od.ErrorRate,
+		BaseEjectionTime:   od.BaseEjectionTime.Duration,
+		MaxEjectionTime:    od.MaxEjectionTime.Duration,
+		MaxEjectionPercent: od.MaxEjectionPercent,
+	}, l)
+}
+
+// setOutlierDetector makes od and the pool's metrics observe the responses proxied by the pool's handler.
+func (p *pool) setOutlierDetector(od *domain.OutlierDetector, l *slog.Logger) {
+	p.outlierDetector = od
+	p.handler = transport.ProxyRequestHandler(p.serverPool, p.tracer, l, od, p.metrics)
+}
+
+// stop ends health checking of a pool that is no longer configured.
+func (p *pool) stop() {
+	p.healthChecker.Stop()
+}
+
+// Pool returns the server pool with the given name, implementing transport.PoolRegistry.
+func (b *balancer) Pool(name string) (domain.ServerPooler, bool) {
+	p, exists := b.state.Load().pools[name]
+	if !exists {
+		return nil, false
+	}
+
+	return p.serverPool, true
+}
+
+// PoolNames returns the pool names in configuration order, implementing transport.PoolRegistry.
+func (b *balancer) PoolNames() []string {
+	conf := b.state.Load().conf
+
+	names := make([]string, 0, len(conf.Pools))
+	for _, pc := range conf.Pools {
+		names = append(names, pc.Name)
+	}
+
+	return names
+}
+
+// NewServer creates a backend for the named pool with the pool's health thresholds, implementing
+// transport.PoolRegistry. A weight of 0 selects the default weight.
+func (b *balancer) NewServer(name, rawURL string, weight int) (domain.Server, error) {
+	p, exists := b.state.Load().pools[name]
+	if !exists {
+		return nil, fmt.Errorf("pool %q not found", name)
+	}
+
+	return newServer(common.BackendConfig{URL: rawURL, Weight: weight}, p.conf.HealthCheck, b.l.With("pool", name))
+}
+
+// start begins health checking until ctx is canceled and serves every listener and the admin API.
+// It fails without serving anything if one of the addresses cannot be bound.
+func (b *balancer) start(ctx context.Context) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.ctx = ctx
+	state := b.state.Load()
+
+	if ac := state.conf.AccessLog; ac.Output != "" {
+		// Zero selects the default when loading the config, so keeping no rotated files is configured as -1.
+		w, err := accesslog.Open(ac.Output, int64(ac.MaxSize)<<20, max(ac.MaxBackups, 0))
+		if err != nil {
+			return fmt.Errorf("accessLog.output: %w", err)
+		}
+
+		b.accessLog = accesslog.New(w, b.accessFormat, b.l)
+	}
+
+	bound, admin, err := b.bindListeners(state.conf)
+	if err != nil {
+		_ = b.accessLog.Close()
+		return err
+	}
+
+	for _, p := range state.pools {
+		p.healthChecker.Start(ctx)
+	}
+
+	if b.exporter != nil {
+		b.exporter.Start()
+	}
+
+	b.serveListeners(state.conf, bound, admin)
+	b.ready.Store(true)
+
+	return nil
+}
+
+// Ready reports whether the load balancer accepts traffic, implementing transport.PoolRegistry.
+func (b *balancer) Ready() bool {
+	return b.ready.Load()
+}
+
+// stop shuts the load balancer down gracefully: it reports not ready, stops accepting connections on every
+// listener and waits up to the configured shutdown timeout for proxied requests in flight to complete.
+// Health checks are stopped and queued spans exported afterwards, and the admin API last, so readiness
+// can be watched while draining.
+// It returns an error if requests were still in flight when the timeout passed.
+func (b *balancer) stop() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.stopping = true
+	b.ready.Store(false)
+
+	state := b.state.Load()
+	timeout := state.conf.Shutdown.Timeout.Duration
+
+	b.l.Info("shutting down load balancer", "timeout", timeout, "listeners", len(b.listeners))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	errs := make(chan error, len(b.listeners))
+
+	for addr, s := range b.listeners {
+		delete(b.listeners, addr)
+
+		go func() {
+			if err := s.Shutdown(ctx); err != nil {
+				errs <- fmt.Errorf("listener %s: %w", addr, err)
+				return
+			}
+
+			errs <- nil
+		}()
+	}
+
+	var shutdownErrs []error
+
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			shutdownErrs = append(shutdownErrs, err)
+		}
+	}
+
+	for _, p := range state.pools {
+		p.stop()
+	}
+
+	if err := b.accessLog.Close(); err != nil {
+		b.l.Error("failed to close access log", "err", err)
+	}
+
+	// Spans of the requests completed above are still queued.
+	if b.exporter != nil {
+		b.exporter.Shutdown()
+	}
+
+	if b.admin != nil {
+		b.shutdown(b.admin, "admin API")
+		b.admin = nil
+	}
+
+	if err := errors.Join(shutdownErrs...); err != nil {
+		return fmt.Errorf("proxied requests still in flight after %v:\n%w", timeout, err)
+	}
+
+	b.l.Info("load balancer stopped, all proxied requests completed")
+
+	return nil
+}
+
+// bindListeners opens the listener addresses of conf that are not served yet, and the admin
+// address if it changed. On failure, every listener opened so far is closed again.
+func (b *balancer) bindListeners(conf *common.Config) (map[string]net.Listener, net.Listener, error) {
+	bound := make(map[string]net.Listener)
+
+	closeAll := func() {
+		for _, ln := range bound {
+			_ = ln.Close()
+		}
+	}
+
+	for i, lc := range conf.Listeners {
+		if _, serving := b.listeners[lc.Address]; serving {
+			continue
+		}
+
+		ln, err := b.listen("tcp", lc.Address)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("listeners[%d].address: %w", i, err)
+		}
+
+		bound[lc.Address] = ln
+	}
+
+	var admin net.Listener
+
+	if conf.Admin.Address != "" && (b.admin == nil || b.admin.Addr != conf.Admin.Address) {
+		ln, err := b.listen("tcp", conf.Admin.Address)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("admin.address: %w", err)
+		}
+
+		admin = ln
+	}
+
+	return bound, admin, nil
+}
+
+// serveListeners serves the listeners opened by bindListeners and shuts down those no longer in conf,
+// letting their in-flight requests complete.
+func (b *balancer) serveListeners(conf *common.Config, bound map[string]net.Listener, admin net.Listener) {
+	configured := make(map[string]bool, len(conf.Listeners))
+
+	for _, lc := range conf.Listeners {
+		configured[lc.Address] = true
+
+		ln, exists := bound[lc.Address]
+		if !exists {
+			continue
+		}
+
+		// The id is assigned first, so the access log and every handler below see it.
+		handler := accesslog.Handler(b.route(lc.Address), b.accessLog)
+		handler = requestid.Handler(handler, b.requestID.Header, b.requestID.TrustIncoming)
+
+		s := newHTTPServer(lc.Address, handler)
+		b.listeners[lc.Address] = s
+		b.l.Info("Load balancer listening at", "listener", lc.Name, "pool", lc.Pool, "addr", s.Addr)
+
+		go b.serve(s, ln, "load balancer")
+	}
+
+	for addr, s := range b.listeners {
+		if !configured[addr] {
+			delete(b.listeners, addr)
+			go b.shutdown(s, "load balancer")
+		}
+	}
+
+	// Serve the admin API on its own listener, so it is never exposed with the proxied traffic.
+	if b.admin != nil && b.admin.Addr != conf.Admin.Address {
+		go b.shutdown(b.admin, "admin API")
+		b.admin = nil
+	}
+
+	if admin != nil {
+		b.admin = newHTTPServer(conf.Admin.Address, b.adminHandler())
+		b.l.Info("Admin API listening at", "addr", b.admin.Addr)
+
+		go b.serve(b.admin, admin, "admin API")
+	}
+}
+
+// adminHandler serves the admin API together with the metrics of every pool on /metrics. Requests get
+// an id like proxied ones, so problem details and logs of the admin API carry it as well.
+func (b *balancer) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", transport.AdminHandler(b, b.logLevel, b.l))
+	mux.Handle("GET /metrics", b.metrics.Handler(b))
+
+	return requestid.Handler(mux, b.requestID.Header, b.requestID.TrustIncoming)
+}
+
+// route returns the handler of a listener, which proxies to the pool the listener is currently configured with.
+func (b *balancer) route(addr string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, exists := b.state.Load().routes[addr]
+		if !exists {
+			// The listener was removed by a reload and is shutting down.
+			common.WriteError(w, r, common.NewServiceUnavailableError("listener is shutting down").
+				WithErrorCode(common.ErrCodeListenerClosed))
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+}
+
+func (b *balancer) serve(s *http.Server, ln net.Listener, name string) {
+	if err := s.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		b.l.Error("failed to serve "+name, "addr", s.Addr, "err", err)
+	}
+}
+
+func (b *balancer) shutdown(s *http.Server, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), listenerShutdownTimeout)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != nil {
+		b.l.Error("failed to shut down "+name, "addr", s.Addr, "err", err)
+		return
+	}
+
+	b.l.Info("stopped "+name, "addr", s.Addr)
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashtishad/golift/internal/common"
+	"github.com/ashtishad/golift/internal/tracing"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// freeAddress returns a loopback address with a port that is free at the time of the call.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+// newBackend starts a backend answering every request with name.
+func newBackend(t *testing.T, name string) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+// testConfig returns a config with one listener on addr proxying to a pool of the given backends.
+func testConfig(addr, strategy string, backends ...string) *common.Config {
+	conf := &common.Config{
+		Listeners: []common.ListenerConfig{{Name: "public", Address: addr, Pool: "web"}},
+		Pools:     []common.PoolConfig{{Name: "web", Strategy: common.StrategyConfig{Name: strategy}}},
+	}
+
+	for _, url := range backends {
+		conf.Pools[0].Backends = append(conf.Pools[0].Backends, common.BackendConfig{URL: url})
+	}
+
+	return conf
+}
+
+// applyDefaults fills unset fields, as done when loading a config file.
+func applyDefaults(t *testing.T, conf *common.Config) *common.Config {
+	t.Helper()
+
+	conf.ApplyDefaults()
+
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("invalid test config: %v", err)
+	}
+
+	return conf
+}
+
+func startBalancer(t *testing.T, conf *common.Config) *balancer {
+	t.Helper()
+
+	lb, err := newBalancer(conf, new(slog.LevelVar), discardLogger())
+	if err != nil {
+		t.Fatalf("failed to create balancer: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	if err := lb.start(ctx); err != nil {
+		t.Fatalf("failed to start balancer: %v", err)
+	}
+
+	return lb
+}
+
+// get returns the body of a request to addr, retrying until the listener accepts connections.
+func get(t *testing.T, addr string) string {
+	t.Helper()
+
+	var lastErr error
+
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get("http://" + addr)
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			return string(body)
+		}
+
+		lastErr = err
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("request to %s failed: %v", addr, lastErr)
+
+	return ""
+}
+
+func poolURLs(t *testing.T, lb *balancer, name string) []string {
+	t.Helper()
+
+	pool, exists := lb.Pool(name)
+	if !exists {
+		t.Fatalf("pool %q not found", name)
+	}
+
+	var urls []string
+	for _, srv := range pool.ListServers() {
+		urls = append(urls, srv.GetURL().String())
+	}
+
+	return urls
+}
+
+// TestBalancer_ReloadBackendsAndStrategy tests that a reload adds and removes backends and replaces
+// the strategy of a running pool, while unchanged backends keep serving as the same server.
+func TestBalancer_ReloadBackendsAndStrategy(t *testing.T) {
+	a, b, c := newBackend(t, "a"), newBackend(t, "b"), newBackend(t, "c")
+	addr := freeAddress(t)
+
+	lb := startBalancer(t, applyDefaults(t, testConfig(addr, "round_robin", a, b)))
+	pool, _ := lb.Pool("web")
+	kept := pool.ListServers()[0]
+
+	if err := lb.reload(applyDefaults(t, testConfig(addr, "p2c", a, c))); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+
+	if got := poolURLs(t, lb, "web"); !slices.Equal(got, []string{a, c}) {
+		t.Errorf("expected backends %v, got %v", []string{a, c}, got)
+	}
+
+	if pool.ListServers()[0] != kept {
+		t.Errorf("expected unchanged backend to be kept")
+	}
+
+	if got := pool.StrategyName(); got != "p2c" {
+		t.Errorf("expected strategy p2c, got %s", got)
+	}
+
+	if body := get(t, addr); body != "a" && body != "c" {
+		t.Errorf("expected a response from a or c, got %q", body)
+	}
+}
+
+// TestBalancer_ReloadKeepsServerStatus tests that a reload changing weights and health thresholds
+// updates the running servers instead of replacing dead backends with alive ones.
+func TestBalancer_ReloadKeepsServerStatus(t *testing.T) {
+	a := newBackend(t, "a")
+	addr := freeAddress(t)
+
+	lb := startBalancer(t, applyDefaults(t, testConfig(addr, "weighted_round_robin", a)))
+	pool, _ := lb.Pool("web")
+	kept := pool.ListServers()[0]
+
+	if appErr := pool.UpdateServerStatus(context.Background(), kept.GetID(), false); appErr != nil {
+		t.Fatalf("failed to mark backend dead: %v", appErr)
+	}
+
+	next := applyDefaults(t, testConfig(addr, "weighted_round_robin", a))
+	next.Pools[0].Backends[0].Weight = 3
+	next.Pools[0].HealthCheck.Rise++
+
+	if err := lb.reload(next); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+
+	srv := pool.ListServers()[0]
+	if srv != kept {
+		t.Fatalf("expected backend to be kept")
+	}
+
+	if srv.IsAlive() {
+		t.Errorf("expected dead backend to stay dead")
+	}
+
+	if got := srv.GetWeight(); got != 3 {
+		t.Errorf("expected weight 3, got %d", got)
+	}
+}
+
+// TestBalancer_ReloadDrainsRemovedBackends tests that a backend removed by a reload completes its
+// requests in flight before it leaves the pool.
+func TestBalancer_ReloadDrainsRemovedBackends(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+
+	// Health checks probe "/", only the proxied request to "/slow" is held.
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+
+		_, _ = io.WriteString(w, "slow")
+	}))
+	t.Cleanup(slow.Close)
+
+	b := newBackend(t, "b")
+	addr := freeAddress(t)
+
+	lb := startBalancer(t, applyDefaults(t, testConfig(addr, "round_robin", slow.URL)))
+
+	// The listener accepts connections once the request to "/" succeeded.
+	_ = get(t, addr)
+
+	body := make(chan string)
+
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	<-started
+
+	if err := lb.reload(applyDefaults(t, testConfig(addr, "round_robin", b))); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+
+	if got := poolURLs(t, lb, "web"); !slices.Equal(got, []string{slow.URL, b}) {
+		t.Errorf("expected removed backend to drain, got %v", got)
+	}
+
+	if got := get(t, addr); got != "b" {
+		t.Errorf("expected new requests to go to b, got %q", got)
+	}
+
+	close(release)
+
+	if got := <-body; got != "slow" {
+		t.Errorf("expected request in flight to complete, got %q", got)
+	}
+
+	for i := 0; i < 50 && len(poolURLs(t, lb, "web")) > 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := poolURLs(t, lb, "web"); !slices.Equal(got, []string{b}) {
+		t.Errorf("expected drained backend to be removed, got %v", got)
+	}
+}
+
+// TestBalancer_ReloadFailureKeepsConfig tests that a reload failing in one pool changes nothing.
+func TestBalancer_ReloadFailureKeepsConfig(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	addr := freeAddress(t)
+
+	lb := startBalancer(t, applyDefaults(t, testConfig(addr, "round_robin", a)))
+
+	next := applyDefaults(t, testConfig(addr, "round_robin", a, b))
+	next.Pools = append(next.Pools, next.Pools[0])
+	next.Pools[1].Name = "broken"
+	next.Pools[1].Strategy.Name = "fastest"
+
+	err := lb.reload(next)
+	if err == nil {
+		t.Fatalf("expected reload to fail")
+	}
+
+	t.Logf("reload error: %v", err)
+
+	if got := poolURLs(t, lb, "web"); !slices.Equal(got, []string{a}) {
+		t.Errorf("expected backends to stay %v, got %v", []string{a}, got)
+	}
+
+	if _, exists := lb.Pool("broken"); exists {
+		t.Errorf("expected failed pool not to be added")
+	}
+}
+
+// TestBalancer_ReloadListeners tests that listeners are added, switched to another pool and removed.
+func TestBalancer_ReloadListeners(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	first, second := freeAddress(t), freeAddress(t)
+
+	lb := startBalancer(t, applyDefaults(t, testConfig(first, "round_robin", a)))
+
+	next := testConfig(second, "round_robin", a)
+	next.Pools = append(next.Pools, common.PoolConfig{Name: "api", Backends: []common.BackendConfig{{URL: b}}})
+	next.Listeners[0].Pool = "api"
+
+	if err := lb.reload(applyDefaults(t, next)); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+
+	if body := get(t, second); body != "b" {
+		t.Errorf("expected new listener to proxy to pool api, got %q", body)
+	}
+
+	// The removed listener shuts down in the background.
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", first)
+		if err != nil {
+			return
+		}
+
+		conn.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Errorf("expected removed listener %s to be closed", first)
+}
+
+// TestBalancer_Stop tests that stopping reports not ready, stops accepting connections and waits for
+// proxied requests in flight, failing if they outlast the shutdown timeout.
+func TestBalancer_Stop(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		release bool // Whether the request in flight completes within the timeout.
+		wantErr bool
+	}{
+		{name: "Drained", timeout: 5 * time.Second, release: true},
+		{name: "Timeout", timeout: 50 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started, release := make(chan struct{}), make(chan struct{})
+			defer close(release)
+
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/slow" {
+					return // Health checks.
+				}
+
+				close(started)
+				<-release
+				_, _ = io.WriteString(w, "done")
+			}))
+			t.Cleanup(backend.Close)
+
+			addr := freeAddress(t)
+			conf := testConfig(addr, "round_robin", backend.URL)
+			conf.Shutdown.Timeout = common.Duration{Duration: tt.timeout}
+
+			lb := startBalancer(t, applyDefaults(t, conf))
+			if !lb.Ready() {
+				t.Fatalf("expected started balancer to be ready")
+			}
+
+			responses := make(chan string, 1)
+
+			go func() {
+				resp, err := http.Get("http://" + addr + "/slow")
+				if err != nil {
+					responses <- err.Error()
+					return
+				}
+				defer resp.Body.Close()
+
+				body, _ := io.ReadAll(resp.Body)
+				responses <- string(body)
+			}()
+			<-started
+
+			stopped := make(chan error, 1)
+
+			go func() { stopped <- lb.stop() }()
+
+			// The listener stops accepting while the request is in flight.
+			for i := 0; i < 50; i++ {
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					break
+				}
+
+				conn.Close()
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if lb.Ready() {
+				t.Errorf("expected stopping balancer not to be ready")
+			}
+
+			if tt.release {
+				release <- struct{}{}
+
+				if body := <-responses; body != "done" {
+					t.Errorf("expected request in flight to complete, got %q", body)
+				}
+			}
+
+			select {
+			case err := <-stopped:
+				if (err != nil) != tt.wantErr {
+					t.Errorf("expected error %v, got %v", tt.wantErr, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected stop to return")
+			}
+
+			if err := lb.reload(applyDefaults(t, testConfig(addr, "round_robin", backend.URL))); err == nil {
+				t.Errorf("expected reload to be rejected after stop")
+			}
+		})
+	}
+}
+
+// TestBalancer_Metrics tests that requests proxied by a listener are counted on the /metrics endpoint
+// of the admin API, labelled by pool, server id and url.
+func TestBalancer_Metrics(t *testing.T) {
+	backend := newBackend(t, "a")
+	addr := freeAddress(t)
+	lb := startBalancer(t, applyDefaults(t, testConfig(addr, "round_robin", backend)))
+
+	if body := get(t, addr); body != "a" {
+		t.Fatalf("expected response of backend a, got %q", body)
+	}
+
+	srvID, err := common.GenerateServerID(backend)
+	if err != nil {
+		t.Fatalf("failed to generate server id: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	lb.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+
+	labels := `pool="web",server_id="` + srvID + `",url="` + backend + `"`
+	for _, line := range []string{
+		`golift_requests_total{` + labels + `,code="2xx"} 1`,
+		`golift_selections_total{` + labels + `,strategy="round_robin"} 1`,
+		`golift_server_alive{` + labels + `} 1`,
+	} {
+		if !slices.Contains(strings.Split(rec.Body.String(), "\n"), line) {
+			t.Errorf("expected line %q in:\n%s", line, rec.Body.String())
+		}
+	}
+}
+
+// TestBalancer_LogLevel tests that the log level changed via the admin API is kept across reloads
+// until the configured level changes.
+func TestBalancer_LogLevel(t *testing.T) {
+	backend := newBackend(t, "a")
+	addr := freeAddress(t)
+	lb := startBalancer(t, applyDefaults(t, testConfig(addr, "round_robin", backend)))
+
+	rec := httptest.NewRecorder()
+	lb.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log/level", strings.NewReader(`{"level": "debug"}`)))
+
+	if rec.Code != http.StatusOK || lb.logLevel.Level() != slog.LevelDebug {
+		t.Fatalf("expected level debug, got %v (status %d)", lb.logLevel.Level(), rec.Code)
+	}
+
+	if err := lb.reload(applyDefaults(t, testConfig(addr, "p2c", backend))); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	if lb.logLevel.Level() != slog.LevelDebug {
+		t.Errorf("expected level debug to be kept by a reload not changing log.level, got %v", lb.logLevel.Level())
+	}
+
+	next := testConfig(addr, "p2c", backend)
+	next.Log.Level = "error"
+
+	if err := lb.reload(applyDefaults(t, next)); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	if lb.logLevel.Level() != slog.LevelError {
+		t.Errorf("expected reloaded level error, got %v", lb.logLevel.Level())
+	}
+}
+
+// TestBalancer_Tracing tests that a proxied request continues the caller's trace: the backend receives
+// a traceparent naming the balancer's span, which is exported to the collector on stop.
+func TestBalancer_Tracing(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/traced" {
+			received <- r.Header.Get(tracing.TraceparentHeader)
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	exported := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		exported <- body
+	}))
+	t.Cleanup(collector.Close)
+
+	addr := freeAddress(t)
+	conf := testConfig(addr, "round_robin", backend.URL)
+	conf.Tracing.Endpoint = collector.URL + "/v1/traces"
+
+	lb := startBalancer(t, applyDefaults(t, conf))
+	get(t, addr) // Waits for the listener.
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/traced", http.NoBody)
+	req.Header.Set(tracing.TraceparentHeader, traceparent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	forwarded, ok := tracing.ParseTraceparent(<-received)
+	if !ok || forwarded.Traceparent() == traceparent || !strings.HasPrefix(forwarded.Traceparent(), traceparent[:36]) {
+		t.Fatalf("expected backend to continue trace %s with the balancer's span, got %+v", traceparent, forwarded)
+	}
+
+	if err := lb.stop(); err != nil {
+		t.Fatalf("failed to stop balancer: %v", err)
+	}
+
+	body := string(<-exported)
+	for _, want := range []string{
+		`"spanId":"` + hex.EncodeToString(forwarded.SpanID[:]) + `"`,
+		`"parentSpanId":"00f067aa0ba902b7"`,
+		`"key":"golift.strategy","value":{"stringValue":"round_robin"}`,
+		`"key":"golift.server.url","value":{"stringValue":"` + backend.URL + `"}`,
+		`"key":"golift.retry.attempts","value":{"intValue":"0"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected exported spans to contain %s, got:\n%s", want, body)
+		}
+	}
+}
+
+// TestBalancer_AccessLog tests that every request of a listener is written to the access log file,
+// including the upstream server, and that the file is complete once the balancer stopped.
+func TestBalancer_AccessLog(t *testing.T) {
+	backend := newBackend(t, "a")
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	addr := freeAddress(t)
+	conf := testConfig(addr, "round_robin", backend)
+	conf.AccessLog = common.AccessLogConfig{Output: path, Format: "json"}
+
+	lb := startBalancer(t, applyDefaults(t, conf))
+	get(t, addr)
+
+	if err := lb.stop(); err != nil {
+		t.Fatalf("failed to stop balancer: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read access log: %v", err)
+	}
+
+	srvID, _ := common.GenerateServerID(backend)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one access log line, got %q", data)
+	}
+
+	for _, want := range []string{`"method":"GET"`, `"status":200`, `"bytesOut":1`, `"serverId":"` + srvID + `"`} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("expected access log line to contain %s, got %s", want, lines[0])
+		}
+	}
+}
+
+// TestBalancer_RequestID tests that a trusted incoming request id is forwarded to the backend,
+// returned to the client once, also if the backend echoes it, access logged and rendered in problem
+// details of the admin API.
+func TestBalancer_RequestID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		_, _ = io.WriteString(w, r.Header.Get("X-Request-ID"))
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	addr := freeAddress(t)
+	conf := testConfig(addr, "round_robin", srv.URL)
+	conf.RequestID.TrustIncoming = true
+	conf.AccessLog = common.AccessLogConfig{Output: path, Format: "json"}
+
+	lb := startBalancer(t, applyDefaults(t, conf))
+
+	if id := get(t, addr); len(id) != 32 {
+		t.Fatalf("expected the backend to receive a generated id, got %q", id)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr, http.NoBody)
+	req.Header.Set("X-Request-ID", "ticket-42")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if got := resp.Header.Values("X-Request-ID"); string(body) != "ticket-42" || !slices.Equal(got, []string{"ticket-42"}) {
+		t.Errorf("expected id ticket-42 forwarded and returned once, got %q and %q", body, got)
+	}
+
+	rec := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/servers/nope", http.NoBody)
+	req.Header.Set("X-Request-ID", "ticket-43")
+	lb.adminHandler().ServeHTTP(rec, req)
+
+	if !strings.Contains(rec.Body.String(), `"requestId":"ticket-43"`) {
+		t.Errorf("expected the id in problem details of the admin API, got %s", rec.Body.String())
+	}
+
+	if err := lb.stop(); err != nil {
+		t.Fatalf("failed to stop balancer: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read access log: %v", err)
+	}
+
+	if !strings.Contains(string(data), `"requestId":"ticket-42"`) {
+		t.Errorf("expected the id in the access log, got %s", data)
+	}
+}
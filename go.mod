@@ -1,3 +1,5 @@
 module github.com/ashtishad/golift
 
 go 1.22.0
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,176 @@
+package accesslog
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ashtishad/golift/internal/requestid"
+)
+
+// Record describes a single request received by a listener, written once its response is complete.
+type Record struct {
+	Time            time.Time     // When the request was received.
+	ClientAddr      string        // Client IP address, without the port.
+	Method          string        // Request method, e.g. "GET".
+	URI             string        // Path and query as sent by the client.
+	Path            string        // Path without the query.
+	Proto           string        // Protocol version, e.g. "HTTP/1.1".
+	Referer         string        // Referer header, empty if absent.
+	UserAgent       string        // User-Agent header, empty if absent.
+	RequestID       string        // Id assigned by requestid.Handler, empty if absent.
+	Status          int           // Status code written to the client.
+	BytesIn         int64         // Request body bytes read.
+	BytesOut        int64         // Response body bytes written.
+	ServerID        string        // Id of the upstream server, empty if no server was selected.
+	UpstreamLatency time.Duration // Round trip to the upstream server.
+	Latency         time.Duration // Total time until the response was written.
+	Retries         int           // Upstream attempts after the first one.
+}
+
+type recordKey struct{}
+
+// RecordUpstream notes the server that served the request of ctx, how long the round trip took
+// and how often the request was retried. It does nothing if the request is not access logged.
+func RecordUpstream(ctx context.Context, srvID string, latency time.Duration, retries int) {
+	if rec, ok := ctx.Value(recordKey{}).(*Record); ok {
+		rec.ServerID, rec.UpstreamLatency, rec.Retries = srvID, latency, retries
+	}
+}
+
+// Logger writes one line per request in the configured format. A nil *Logger logs nothing.
+type Logger struct {
+	format Format
+	l      *slog.Logger
+
+	mux sync.Mutex
+	w   io.Writer
+}
+
+// New creates a logger writing records rendered by format to w.
+func New(w io.Writer, format Format, l *slog.Logger) *Logger {
+	return &Logger{format: format, l: l, w: w}
+}
+
+// Log writes rec as a single line.
+func (al *Logger) Log(rec *Record) {
+	line := append(al.format(make([]byte, 0, 256), rec), '\n')
+
+	al.mux.Lock()
+	_, err := al.w.Write(line)
+	al.mux.Unlock()
+
+	if err != nil {
+		al.l.Error("failed to write access log", "err", err)
+	}
+}
+
+// Close closes the output, standard output is left open.
+func (al *Logger) Close() error {
+	if al == nil {
+		return nil
+	}
+
+	if c, ok := al.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// Handler logs every request served by next with al, it returns next itself if al is nil.
+func Handler(next http.Handler, al *Logger) http.Handler {
+	if al == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &Record{
+			Time:      time.Now(),
+			Method:    r.Method,
+			URI:       r.URL.RequestURI(),
+			Path:      r.URL.Path,
+			Proto:     r.Proto,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+			RequestID: requestid.FromContext(r.Context()),
+		}
+
+		rec.ClientAddr = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			rec.ClientAddr = host
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+
+		rw := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), recordKey{}, rec)))
+
+		rec.Latency = time.Since(rec.Time)
+		rec.Status = rw.Status()
+		rec.BytesIn, rec.BytesOut = body.n, rw.n
+
+		al.Log(rec)
+	})
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.n += int64(n)
+
+	return n, err
+}
+
+// responseRecorder captures the status code and counts the bytes of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	// Informational 1xx headers may precede the final status.
+	if rw.status == 0 && code >= http.StatusOK {
+		rw.status = code
+	}
+
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+
+	n, err := rw.ResponseWriter.Write(b)
+	rw.n += int64(n)
+
+	return n, err
+}
+
+// Status returns the recorded status code, 200 if the handler never wrote a header.
+func (rw *responseRecorder) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+
+	return rw.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. for flushing.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
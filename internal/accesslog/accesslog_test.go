@@ -0,0 +1,210 @@
+package accesslog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashtishad/golift/internal/requestid"
+)
+
+func testRecord() *Record {
+	return &Record{
+		Time:            time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+		ClientAddr:      "127.0.0.1",
+		Method:          http.MethodGet,
+		URI:             "/index.html?q=1",
+		Path:            "/index.html",
+		Proto:           "HTTP/1.1",
+		UserAgent:       `curl/8.0 "quoted"`,
+		RequestID:       "req-1",
+		Status:          http.StatusOK,
+		BytesIn:         12,
+		BytesOut:        2326,
+		ServerID:        "srv",
+		UpstreamLatency: 1500 * time.Microsecond,
+		Latency:         2 * time.Millisecond,
+	}
+}
+
+// TestNewFormat tests that every format renders a record as a single line.
+func TestNewFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		template string
+		want     string
+	}{
+		{
+			name:   "Common",
+			format: "common",
+			want:   `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html?q=1 HTTP/1.1" 200 2326`,
+		},
+		{
+			name:   "Combined",
+			format: "combined",
+			want:   `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html?q=1 HTTP/1.1" 200 2326 "-" "curl/8.0 \"quoted\""`,
+		},
+		{
+			name:   "JSON",
+			format: "json",
+			want: `{"time":"2000-10-10T13:55:36-07:00","clientAddr":"127.0.0.1","method":"GET","path":"/index.html",` +
+				`"uri":"/index.html?q=1","proto":"HTTP/1.1","status":200,"bytesIn":12,"bytesOut":2326,"serverId":"srv",` +
+				`"upstreamLatencyMs":1.5,"latencyMs":2,"retries":0,"requestId":"req-1","userAgent":"curl/8.0 \"quoted\""}`,
+		},
+		{
+			name:     "Template",
+			format:   "template",
+			template: "{{.Method}} {{.Path}}\n{{.Status}} {{.ServerID}} {{.Latency}}",
+			want:     "GET /index.html 200 srv 2ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := NewFormat(tt.format, tt.template)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := string(format(nil, testRecord())); got != tt.want {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestNewFormat_Invalid tests that unknown formats and broken templates are rejected.
+func TestNewFormat_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		template string
+		want     string
+	}{
+		{name: "Unknown Format", format: "apache", want: `unknown format "apache"`},
+		{name: "Missing Template", format: "template", want: "requires a template"},
+		{name: "Syntax Error", format: "template", template: "{{.Method", want: "unclosed action"},
+		{name: "Unknown Field", format: "template", template: "{{.Host}}", want: "can't evaluate field Host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFormat(tt.format, tt.template)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestHandler tests that the middleware records the response and the upstream noted by the proxy handler.
+func TestHandler(t *testing.T) {
+	var out bytes.Buffer
+
+	format, _ := NewFormat("template", "{{.Method}} {{.Path}} {{.Status}} {{.BytesIn}} {{.BytesOut}} {{.ServerID}} {{.Retries}} {{.RequestID}}")
+	al := New(&out, format, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		RecordUpstream(r.Context(), "srv-1", time.Millisecond, 1)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "created")
+	}), al)
+
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("payload"))
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(requestid.NewContext(req.Context(), "req-1")))
+
+	if want := "POST /items 201 7 7 srv-1 1 req-1\n"; out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+
+	if next := http.NotFoundHandler(); Handler(next, nil) == nil {
+		t.Errorf("expected handler without logger to be returned as is")
+	}
+}
+
+// TestRotatingFile tests that the file is rotated before it exceeds its size and old backups are deleted.
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	rf, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer rf.Close()
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	want := map[string]string{path: "line-4\n", path + ".1": "line-3\n", path + ".2": "line-2\n"}
+	for file, content := range want {
+		got, err := os.ReadFile(file)
+		if err != nil || string(got) != content {
+			t.Errorf("expected %s to contain %q, got %q (%v)", file, content, got, err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups to be kept")
+	}
+}
+
+// TestRotatingFile_RotationFails tests that writes continue in the current file while it cannot be rotated.
+func TestRotatingFile_RotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	rf, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer rf.Close()
+
+	// A non-empty directory in place of the backup makes renaming the file fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	if _, err := rf.Write([]byte("line-1\n")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if n, err := rf.Write([]byte("line-2\n")); err == nil || n != len("line-2\n") {
+		t.Fatalf("expected the line to be written despite a rotation error, got %d (%v)", n, err)
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatalf("failed to remove directory: %v", err)
+	}
+
+	if _, err := rf.Write([]byte("line-3\n")); err != nil {
+		t.Fatalf("expected rotation to be retried, got %v", err)
+	}
+
+	want := map[string]string{path: "line-3\n", path + ".1": "line-1\nline-2\n"}
+	for file, content := range want {
+		got, err := os.ReadFile(file)
+		if err != nil || string(got) != content {
+			t.Errorf("expected %s to contain %q, got %q (%v)", file, content, got, err)
+		}
+	}
+
+	if err := rf.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if _, err := rf.Write([]byte("line-4\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected writes after Close to fail with %v, got %v", os.ErrClosed, err)
+	}
+}
@@ -0,0 +1,148 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// Format appends rec rendered as a single line, without the trailing newline, to b.
+type Format func(b []byte, rec *Record) []byte
+
+// Formats lists the names accepted by NewFormat.
+var Formats = []string{"common", "combined", "json", "template"}
+
+// clfTime is the timestamp layout of the Common Log Format.
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// NewFormat returns the format with the given name. The "template" format renders tmpl, a text/template
+// executed with the *Record, e.g. `{{.Method}} {{.Path}} {{.Status}} {{.Latency}}`.
+func NewFormat(name, tmpl string) (Format, error) {
+	switch name {
+	case "common":
+		return formatCommon, nil
+	case "combined":
+		return formatCombined, nil
+	case "json":
+		return formatJSON, nil
+	case "template":
+		return newTemplateFormat(tmpl)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected one of %v", name, Formats)
+	}
+}
+
+// formatCommon renders the Common Log Format, e.g.
+// 127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326.
+func formatCommon(b []byte, rec *Record) []byte {
+	b = append(b, dash(rec.ClientAddr)...)
+	b = append(b, " - - ["...)
+	b = rec.Time.AppendFormat(b, clfTime)
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, rec.Method+" "+rec.URI+" "+rec.Proto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(rec.Status), 10)
+	b = append(b, ' ')
+
+	if rec.BytesOut == 0 {
+		return append(b, '-')
+	}
+
+	return strconv.AppendInt(b, rec.BytesOut, 10)
+}
+
+// formatCombined renders the Combined Log Format, the Common Log Format followed by referer and user agent.
+func formatCombined(b []byte, rec *Record) []byte {
+	b = formatCommon(b, rec)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, dash(rec.Referer))
+	b = append(b, ' ')
+
+	return strconv.AppendQuote(b, dash(rec.UserAgent))
+}
+
+// jsonRecord is a Record as rendered by the json format, latencies in milliseconds.
+type jsonRecord struct {
+	Time              string  `json:"time"`
+	ClientAddr        string  `json:"clientAddr"`
+	Method            string  `json:"method"`
+	Path              string  `json:"path"`
+	URI               string  `json:"uri"`
+	Proto             string  `json:"proto"`
+	Status            int     `json:"status"`
+	BytesIn           int64   `json:"bytesIn"`
+	BytesOut          int64   `json:"bytesOut"`
+	ServerID          string  `json:"serverId,omitempty"`
+	UpstreamLatencyMs float64 `json:"upstreamLatencyMs"`
+	LatencyMs         float64 `json:"latencyMs"`
+	Retries           int     `json:"retries"`
+	RequestID         string  `json:"requestId,omitempty"`
+	Referer           string  `json:"referer,omitempty"`
+	UserAgent         string  `json:"userAgent,omitempty"`
+}
+
+func formatJSON(b []byte, rec *Record) []byte {
+	line, _ := json.Marshal(jsonRecord{
+		Time:              rec.Time.Format(time.RFC3339Nano),
+		ClientAddr:        rec.ClientAddr,
+		Method:            rec.Method,
+		Path:              rec.Path,
+		URI:               rec.URI,
+		Proto:             rec.Proto,
+		Status:            rec.Status,
+		BytesIn:           rec.BytesIn,
+		BytesOut:          rec.BytesOut,
+		ServerID:          rec.ServerID,
+		UpstreamLatencyMs: milliseconds(rec.UpstreamLatency),
+		LatencyMs:         milliseconds(rec.Latency),
+		Retries:           rec.Retries,
+		RequestID:         rec.RequestID,
+		Referer:           rec.Referer,
+		UserAgent:         rec.UserAgent,
+	})
+
+	return append(b, line...)
+}
+
+// newTemplateFormat parses tmpl and checks that it renders a zero Record, so unknown fields fail at startup.
+func newTemplateFormat(tmpl string) (Format, error) {
+	if tmpl == "" {
+		return nil, errors.New("template format requires a template")
+	}
+
+	t, err := template.New("accessLog").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.Execute(&bytes.Buffer{}, &Record{}); err != nil {
+		return nil, err
+	}
+
+	return func(b []byte, rec *Record) []byte {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, rec); err != nil {
+			return fmt.Appendf(b, "access log template failed: %v", err)
+		}
+
+		// Every record is a single line.
+		return append(b, bytes.ReplaceAll(buf.Bytes(), []byte("\n"), []byte(" "))...)
+	}, nil
+}
+
+// dash returns "-", the Common Log Format placeholder of missing values, if s is empty.
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,158 @@
+package accesslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Open returns the writer for output: standard output for "stdout", or else the file at that path,
+// appended to and rotated once it would exceed maxSize bytes, keeping maxBackups rotated files.
+func Open(output string, maxSize int64, maxBackups int) (io.WriteCloser, error) {
+	if output == "stdout" {
+		return stdout{os.Stdout}, nil
+	}
+
+	return OpenRotatingFile(output, maxSize, maxBackups)
+}
+
+// stdout is standard output, which is left open when the access log is closed.
+type stdout struct {
+	io.Writer
+}
+
+func (stdout) Close() error {
+	return nil
+}
+
+// RotatingFile is an append-only file that is rotated before a write would make it exceed maxSize bytes:
+// path.1 is renamed to path.2 and so on, path to path.1, and a new file is started at path.
+// At most maxBackups rotated files are kept, a file is truncated instead if maxBackups is 0.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mux    sync.Mutex
+	f      *os.File // Nil after Close, or if the file could not be reopened after a failed rotation.
+	size   int64
+	closed bool
+}
+
+// OpenRotatingFile opens or creates the file at path for appending.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	//nolint:gosec // Access logs are read by log shippers running as another user.
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	rf.f, rf.size = f, info.Size()
+
+	return nil
+}
+
+// Write appends p, rotating the file first if p does not fit anymore. If the rotation fails, p is still
+// appended to the current file and the rotation error is returned, rotation is retried on the next write.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mux.Lock()
+	defer rf.mux.Unlock()
+
+	if rf.closed {
+		return 0, os.ErrClosed
+	}
+
+	if rf.f == nil {
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	var rotateErr error
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			rotateErr = fmt.Errorf("unable to rotate %s: %w", rf.path, err)
+			if rf.f == nil {
+				return 0, rotateErr
+			}
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+
+	if err != nil {
+		return n, err
+	}
+
+	return n, rotateErr
+}
+
+// rotate shifts the rotated files and starts a new file, it must be called with mux held.
+// If the files cannot be shifted, the current file is reopened, leaving rf.f nil only if that fails too.
+func (rf *RotatingFile) rotate() error {
+	err := rf.f.Close()
+	rf.f = nil
+
+	if err == nil {
+		err = rf.shift()
+	}
+
+	return errors.Join(err, rf.open())
+}
+
+// shift renames path.1 to path.2 and so on and path to path.1, or removes path if no backups are kept.
+func (rf *RotatingFile) shift() error {
+	for i := rf.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(rf.backup(i), rf.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if rf.maxBackups > 0 {
+		if err := os.Rename(rf.path, rf.backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(rf.path); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (rf *RotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", rf.path, i)
+}
+
+// Close closes the file, later writes fail.
+func (rf *RotatingFile) Close() error {
+	rf.mux.Lock()
+	defer rf.mux.Unlock()
+
+	rf.closed = true
+	if rf.f == nil {
+		return nil
+	}
+
+	err := rf.f.Close()
+	rf.f = nil
+
+	return err
+}
@@ -1,20 +1,66 @@
 package common
 
 import (
-	"fmt"
 	"net/http"
 )
 
+// Stable machine-readable error codes, rendered as the "code" member of problem details.
+// Clients should match on these rather than on messages, which may change.
+const (
+	ErrCodeBadRequest         = "bad_request"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeConflict           = "conflict"
+	ErrCodeInternal           = "internal_error"
+	ErrCodeBadGateway         = "bad_gateway"
+	ErrCodeServiceUnavailable = "service_unavailable"
+	ErrCodeGatewayTimeout     = "gateway_timeout"
+
+	ErrCodeInvalidRequestBody = "invalid_request_body"
+	ErrCodeInvalidStrategy    = "invalid_strategy"
+	ErrCodeInvalidServer      = "invalid_server"
+	ErrCodeInvalidLogLevel    = "invalid_log_level"
+	ErrCodeInvalidTimeout     = "invalid_timeout"
+	ErrCodePoolNotFound       = "pool_not_found"
+	ErrCodeServerNotFound     = "server_not_found"
+	ErrCodeServerExists       = "server_already_exists"
+	ErrCodeNoServerAvailable  = "no_server_available"
+	ErrCodeListenerClosed     = "listener_closed"
+	ErrCodeShuttingDown       = "shutting_down"
+)
+
+// statusErrCodes are the codes of errors created without a more specific one.
+var statusErrCodes = map[int]string{
+	http.StatusBadRequest:          ErrCodeBadRequest,
+	http.StatusUnauthorized:        ErrCodeUnauthorized,
+	http.StatusNotFound:            ErrCodeNotFound,
+	http.StatusConflict:            ErrCodeConflict,
+	http.StatusInternalServerError: ErrCodeInternal,
+	http.StatusBadGateway:          ErrCodeBadGateway,
+	http.StatusServiceUnavailable:  ErrCodeServiceUnavailable,
+	http.StatusGatewayTimeout:      ErrCodeGatewayTimeout,
+}
+
 type AppError interface {
 	Error() string
 	Code() int
+
+	// ErrorCode returns the stable machine-readable code of the error, e.g. "server_not_found".
+	ErrorCode() string
+
+	// WithErrorCode replaces the code derived from the status with a more specific one.
+	WithErrorCode(code string) AppError
+
+	// Cause records err as the underlying error, which errors.Is and errors.As see through Unwrap.
 	Cause(err error) error
+	Unwrap() error
 }
 
 type Error struct {
 	Message    string
 	StatusCode int
-	Err        error // Field for the wrapped error
+	ErrCode    string // Machine-readable code, derived from StatusCode if empty.
+	Err        error  // Field for the wrapped error
 }
 
 func (e *Error) Error() string {
@@ -25,13 +71,36 @@ func (e *Error) Code() int {
 	return e.StatusCode
 }
 
+// ErrorCode returns the code set with WithErrorCode, or the generic code of the status.
+func (e *Error) ErrorCode() string {
+	if e.ErrCode != "" {
+		return e.ErrCode
+	}
+
+	if code, exists := statusErrCodes[e.StatusCode]; exists {
+		return code
+	}
+
+	return ErrCodeInternal
+}
+
+func (e *Error) WithErrorCode(code string) AppError {
+	e.ErrCode = code
+	return e
+}
+
 func (e *Error) Cause(err error) error {
 	if err != nil {
-		e.Err = fmt.Errorf("%w", err)
+		e.Err = err
 	}
 	return e
 }
 
+// Unwrap returns the wrapped error, so the chain recorded with Cause is not lost.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 func NewBadRequestError(message string) AppError {
 	return &Error{
 		Message:    message,
@@ -70,3 +139,30 @@ func NewConflictError(message string) AppError {
 		StatusCode: http.StatusConflict,
 	}
 }
+
+// NewServiceUnavailableError creates a new APIError for requests that cannot be served right now,
+// e.g. because no server of the pool is alive.
+func NewServiceUnavailableError(message string) AppError {
+	return &Error{
+		Message:    message,
+		StatusCode: http.StatusServiceUnavailable,
+	}
+}
+
+// NewBadGatewayError creates a new APIError for failed round trips to a backend.
+func NewBadGatewayError(message string, err error) AppError {
+	return &Error{
+		Message:    message,
+		StatusCode: http.StatusBadGateway,
+		Err:        err,
+	}
+}
+
+// NewGatewayTimeoutError creates a new APIError for backends that did not answer in time.
+func NewGatewayTimeoutError(message string, err error) AppError {
+	return &Error{
+		Message:    message,
+		StatusCode: http.StatusGatewayTimeout,
+		Err:        err,
+	}
+}
@@ -0,0 +1,635 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashtishad/golift/internal/requestid"
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes the listeners, backend pools and auxiliary servers of the load balancer.
+// It is loaded from a YAML or JSON file, environment variables override selected fields.
+type Config struct {
+	Listeners   []ListenerConfig  `yaml:"listeners"`
+	Admin       AdminConfig       `yaml:"admin"`
+	DemoServers DemoServersConfig `yaml:"demoServers"`
+	Shutdown    ShutdownConfig    `yaml:"shutdown"`
+	Log         LogConfig         `yaml:"log"`
+	RequestID   RequestIDConfig   `yaml:"requestId"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	AccessLog   AccessLogConfig   `yaml:"accessLog"`
+	Pools       []PoolConfig      `yaml:"pools"`
+}
+
+// ListenerConfig binds an address to the pool its requests are proxied to.
+type ListenerConfig struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"` // host:port to listen on.
+	Pool    string `yaml:"pool"`    // Name of the pool serving this listener.
+}
+
+// AdminConfig configures the admin API listener, it is disabled if Address is empty.
+type AdminConfig struct {
+	Address string `yaml:"address"`
+}
+
+// DemoServersConfig starts Count "Hello World" backends on consecutive ports for local testing.
+type DemoServersConfig struct {
+	Count        int `yaml:"count"`
+	StartingPort int `yaml:"startingPort"`
+}
+
+// ShutdownConfig configures the graceful shutdown on SIGINT and SIGTERM.
+type ShutdownConfig struct {
+	Timeout Duration `yaml:"timeout"` // Upper bound for proxied requests in flight to complete.
+}
+
+// LogConfig configures the process logger. The level can also be changed at runtime via the admin API.
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error.
+	Format string `yaml:"format"` // text or json.
+	Source bool   `yaml:"source"` // Whether records carry the file and line that emitted them.
+}
+
+// RequestIDConfig configures the id assigned to every request received by a listener. The id is forwarded to
+// the backend, returned to the client, logged and rendered in problem details.
+type RequestIDConfig struct {
+	Header        string `yaml:"header"`        // Header carrying the id, X-Request-ID by default.
+	TrustIncoming bool   `yaml:"trustIncoming"` // Keep an id sent by the client instead of assigning a new one.
+}
+
+// TracingConfig configures a span per proxied request exported via OTLP/HTTP, it is disabled if Endpoint is empty.
+type TracingConfig struct {
+	Endpoint    string  `yaml:"endpoint"`    // OTLP/HTTP traces URL, e.g. "http://127.0.0.1:4318/v1/traces".
+	ServiceName string  `yaml:"serviceName"` // Reported as the service.name resource attribute.
+	SampleRatio float64 `yaml:"sampleRatio"` // Fraction (0..1] of traces started by the load balancer that are recorded.
+}
+
+// AccessLogConfig configures a line per request received by a listener, it is disabled if Output is empty.
+type AccessLogConfig struct {
+	Output     string `yaml:"output"`             // "stdout" or the path of a file.
+	Format     string `yaml:"format"`             // common, combined, json or template.
+	Template   string `yaml:"template,omitempty"` // text/template of a line for the template format.
+	MaxSize    int    `yaml:"maxSize"`            // Megabytes a file grows to before it is rotated.
+	MaxBackups int    `yaml:"maxBackups"`         // Rotated files kept, older ones are deleted, -1 keeps none.
+}
+
+// PoolConfig describes a named set of backends and how requests are balanced across them.
+type PoolConfig struct {
+	Name             string                 `yaml:"name"`
+	Strategy         StrategyConfig         `yaml:"strategy"`
+	HealthCheck      HealthCheckConfig      `yaml:"healthCheck"`
+	OutlierDetection OutlierDetectionConfig `yaml:"outlierDetection"`
+	Backends         []BackendConfig        `yaml:"backends"`
+}
+
+// StrategyConfig selects a registered load balancing strategy by name.
+type StrategyConfig struct {
+	Name    string            `yaml:"name"`
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// HealthCheckConfig configures active probing of a pool's backends.
+type HealthCheckConfig struct {
+	Path             string   `yaml:"path"`
+	Interval         Duration `yaml:"interval"`
+	Timeout          Duration `yaml:"timeout"`
+	ExpectedStatuses []int    `yaml:"expectedStatuses,omitempty"`
+	ExpectedBody     string   `yaml:"expectedBody,omitempty"`
+	Rise             int      `yaml:"rise"`
+	Fall             int      `yaml:"fall"`
+	HoldDown         Duration `yaml:"holdDown"`
+}
+
+// OutlierDetectionConfig configures passive ejection of backends based on proxied traffic.
+type OutlierDetectionConfig struct {
+	ErrorRate          float64  `yaml:"errorRate"`
+	MinRequests        int      `yaml:"minRequests"`
+	Interval           Duration `yaml:"interval"`
+	BaseEjectionTime   Duration `yaml:"baseEjectionTime"`
+	MaxEjectionTime    Duration `yaml:"maxEjectionTime"`
+	MaxEjectionPercent int      `yaml:"maxEjectionPercent"`
+}
+
+// MaxWeight is the largest backend weight, it bounds the per-server state of weighted strategies such as ring points.
+const MaxWeight = 256
+
+// BackendConfig is a single backend server of a pool.
+type BackendConfig struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+// Duration is a time.Duration written as a Go duration string such as "1m30s" in config files.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalYAML parses a duration string.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q, expected e.g. \"5s\"", value.Line, value.Value)
+	}
+
+	d.Duration = parsed
+
+	return nil
+}
+
+// MarshalYAML writes the duration as a string.
+func (d Duration) MarshalYAML() (any, error) {
+	return d.String(), nil
+}
+
+// LoadConfig loads the configuration from the file at path, or the built-in defaults if path is empty,
+// and applies environment variable overrides. Invalid values fail with the path of the offending field.
+func LoadConfig(path string, l *slog.Logger) (*Config, error) {
+	config := DefaultConfig()
+
+	if path != "" {
+		fileConfig, err := ReadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		config = fileConfig
+	}
+
+	if err := applyEnv(config, path == "", l); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return config, nil
+}
+
+// ReadConfigFile parses a YAML or JSON config file and fills unset fields with defaults.
+// Unknown fields are rejected, so typos do not silently fall back to defaults.
+func ReadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	var config Config
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	config.ApplyDefaults()
+
+	return &config, nil
+}
+
+// DefaultConfig returns the configuration used without a config file: five demo servers on ports
+// 8000-8004 balanced by a single pool behind 127.0.0.1:8080, and the admin API on 127.0.0.1:9090.
+func DefaultConfig() *Config {
+	config := &Config{
+		Listeners:   []ListenerConfig{{Name: "default", Address: "127.0.0.1:8080", Pool: "default"}},
+		Admin:       AdminConfig{Address: "127.0.0.1:9090"},
+		DemoServers: DemoServersConfig{Count: 5, StartingPort: 8000},
+		Pools:       []PoolConfig{{Name: "default"}},
+	}
+
+	config.Pools[0].Backends = demoBackends(config.DemoServers)
+	config.ApplyDefaults()
+
+	return config
+}
+
+// demoBackends returns the backends pointing at the demo servers.
+func demoBackends(demo DemoServersConfig) []BackendConfig {
+	backends := make([]BackendConfig, 0, demo.Count)
+	for i := 0; i < demo.Count; i++ {
+		backends = append(backends, BackendConfig{URL: fmt.Sprintf("http://localhost:%d", demo.StartingPort+i)})
+	}
+
+	return backends
+}
+
+// ApplyDefaults fills fields left empty in the config file.
+func (c *Config) ApplyDefaults() {
+	if c.DemoServers.Count > 0 && c.DemoServers.StartingPort == 0 {
+		c.DemoServers.StartingPort = 8000
+	}
+
+	if c.Shutdown.Timeout.Duration == 0 {
+		c.Shutdown.Timeout.Duration = 30 * time.Second
+	}
+
+	if c.Log.Level == "" {
+		c.Log.Level = "info"
+	}
+
+	if c.Log.Format == "" {
+		c.Log.Format = "text"
+	}
+
+	if c.RequestID.Header == "" {
+		c.RequestID.Header = requestid.DefaultHeader
+	}
+
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "golift"
+	}
+
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = 1
+	}
+
+	if c.AccessLog.Format == "" {
+		c.AccessLog.Format = "combined"
+	}
+
+	if c.AccessLog.MaxSize == 0 {
+		c.AccessLog.MaxSize = 100
+	}
+
+	if c.AccessLog.MaxBackups == 0 {
+		c.AccessLog.MaxBackups = 5
+	}
+
+	for i := range c.Pools {
+		p := &c.Pools[i]
+
+		if p.Strategy.Name == "" {
+			p.Strategy.Name = "least_connection"
+		}
+
+		p.HealthCheck.applyDefaults()
+		p.OutlierDetection.applyDefaults()
+
+		for j := range p.Backends {
+			if p.Backends[j].Weight == 0 {
+				p.Backends[j].Weight = 1
+			}
+		}
+	}
+}
+
+func (h *HealthCheckConfig) applyDefaults() {
+	if h.Path == "" {
+		h.Path = "/"
+	}
+
+	if h.Interval.Duration == 0 {
+		h.Interval.Duration = 5 * time.Second
+	}
+
+	// The default timeout is shortened for short intervals, as probes must finish before the next one starts.
+	if h.Timeout.Duration == 0 && h.Interval.Duration > 0 {
+		h.Timeout.Duration = min(2*time.Second, h.Interval.Duration/2)
+	}
+
+	if h.Rise == 0 {
+		h.Rise = 2
+	}
+
+	if h.Fall == 0 {
+		h.Fall = 3
+	}
+}
+
+func (o *OutlierDetectionConfig) applyDefaults() {
+	if o.ErrorRate == 0 {
+		o.ErrorRate = 0.5
+	}
+
+	if o.MinRequests == 0 {
+		o.MinRequests = 20
+	}
+
+	if o.Interval.Duration == 0 {
+		o.Interval.Duration = 10 * time.Second
+	}
+
+	if o.BaseEjectionTime.Duration == 0 {
+		o.BaseEjectionTime.Duration = 30 * time.Second
+	}
+
+	if o.MaxEjectionTime.Duration == 0 {
+		o.MaxEjectionTime.Duration = 5 * time.Minute
+	}
+
+	if o.MaxEjectionPercent == 0 {
+		o.MaxEjectionPercent = 50
+	}
+}
+
+// Validate checks every field and returns all problems found, each prefixed with its field path,
+// e.g. "pools[0].backends[1].url: missing port".
+func (c *Config) Validate() error {
+	var errs []error
+
+	fail := func(path, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	if len(c.Listeners) == 0 {
+		fail("listeners", "at least one listener is required")
+	}
+
+	if len(c.Pools) == 0 {
+		fail("pools", "at least one pool is required")
+	}
+
+	pools := make(map[string]bool, len(c.Pools))
+
+	for i, p := range c.Pools {
+		path := fmt.Sprintf("pools[%d]", i)
+
+		switch {
+		case p.Name == "":
+			fail(path+".name", "must not be empty")
+		case pools[p.Name]:
+			fail(path+".name", "duplicate pool name %q", p.Name)
+		}
+
+		pools[p.Name] = true
+
+		if p.Strategy.Name == "" {
+			fail(path+".strategy.name", "must not be empty")
+		}
+
+		p.HealthCheck.validate(path+".healthCheck", fail)
+		p.OutlierDetection.validate(path+".outlierDetection", fail)
+
+		backends := make(map[string]int, len(p.Backends)) // Index of the first backend with a server id.
+
+		for j, b := range p.Backends {
+			bPath := fmt.Sprintf("%s.backends[%d]", path, j)
+
+			if err := ValidateBackendURL(b.URL); err != nil {
+				fail(bPath+".url", "%v", err)
+			} else if srvID, err := GenerateServerID(b.URL); err == nil {
+				if first, exists := backends[srvID]; exists {
+					fail(bPath+".url", "duplicate backend %q, same server as backends[%d]", b.URL, first)
+				} else {
+					backends[srvID] = j
+				}
+			}
+
+			if b.Weight < 1 || b.Weight > MaxWeight {
+				fail(bPath+".weight", "must be between 1 and %d, got %d", MaxWeight, b.Weight)
+			}
+		}
+	}
+
+	listeners := make(map[string]bool, len(c.Listeners))
+
+	var addrs []boundAddress
+
+	for i, lc := range c.Listeners {
+		path := fmt.Sprintf("listeners[%d]", i)
+
+		switch {
+		case lc.Name == "":
+			fail(path+".name", "must not be empty")
+		case listeners[lc.Name]:
+			fail(path+".name", "duplicate listener name %q", lc.Name)
+		}
+
+		listeners[lc.Name] = true
+
+		if err := validateAddress(lc.Address); err != nil {
+			fail(path+".address", "%v", err)
+		} else {
+			addrs = append(addrs, newBoundAddress(path+".address", lc.Address))
+		}
+
+		if !pools[lc.Pool] {
+			fail(path+".pool", "unknown pool %q", lc.Pool)
+		}
+	}
+
+	if c.Admin.Address != "" {
+		if err := validateAddress(c.Admin.Address); err != nil {
+			fail("admin.address", "%v", err)
+		} else {
+			addrs = append(addrs, newBoundAddress("admin.address", c.Admin.Address))
+		}
+	}
+
+	if c.DemoServers.Count < 0 {
+		fail("demoServers.count", "must not be negative, got %d", c.DemoServers.Count)
+	}
+
+	if c.DemoServers.Count > 0 {
+		lastPort := c.DemoServers.StartingPort + c.DemoServers.Count - 1
+		if !validPort(c.DemoServers.StartingPort) || !validPort(lastPort) {
+			fail("demoServers.startingPort", "must leave %d ports between 1 and 65535, got %d",
+				c.DemoServers.Count, c.DemoServers.StartingPort)
+		} else {
+			// Demo servers listen on every interface.
+			for i := 0; i < c.DemoServers.Count; i++ {
+				addrs = append(addrs, boundAddress{path: fmt.Sprintf("demoServers[%d]", i), port: c.DemoServers.StartingPort + i})
+			}
+		}
+	}
+
+	if c.Shutdown.Timeout.Duration < 0 {
+		fail("shutdown.timeout", "must not be negative, got %v", c.Shutdown.Timeout)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		fail("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+
+	if !slices.Contains(LogFormats, c.Log.Format) {
+		fail("log.format", "must be one of %v, got %q", LogFormats, c.Log.Format)
+	}
+
+	if !validHeaderName(c.RequestID.Header) {
+		fail("requestId.header", "invalid header name %q", c.RequestID.Header)
+	}
+
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("tracing.endpoint", "must be an absolute http or https URL, got %q", c.Tracing.Endpoint)
+		}
+
+		if c.Tracing.SampleRatio <= 0 || c.Tracing.SampleRatio > 1 {
+			fail("tracing.sampleRatio", "must be within (0, 1], got %v", c.Tracing.SampleRatio)
+		}
+	}
+
+	if c.AccessLog.MaxSize < 1 {
+		fail("accessLog.maxSize", "must be at least 1, got %d", c.AccessLog.MaxSize)
+	}
+
+	if c.AccessLog.MaxBackups < -1 {
+		fail("accessLog.maxBackups", "must be at least -1, got %d", c.AccessLog.MaxBackups)
+	}
+
+	for i, a := range addrs {
+		for _, other := range addrs[:i] {
+			if a.conflicts(other) {
+				fail(a.path, "port %d conflicts with %s", a.port, other.path)
+				break
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// boundAddress is an address the load balancer listens on, together with the field configuring it.
+type boundAddress struct {
+	path string
+	host string
+	port int
+}
+
+// newBoundAddress parses an address already checked by validateAddress.
+func newBoundAddress(path, addr string) boundAddress {
+	host, port, _ := net.SplitHostPort(addr)
+	n, _ := strconv.Atoi(port)
+
+	return boundAddress{path: path, host: host, port: n}
+}
+
+// conflicts reports whether a and other cannot be bound at the same time: they share a port and
+// either the same host or one of them listens on every interface.
+func (a boundAddress) conflicts(other boundAddress) bool {
+	wildcard := func(host string) bool { return host == "" || host == "0.0.0.0" || host == "::" }
+
+	return a.port == other.port && (a.host == other.host || wildcard(a.host) || wildcard(other.host))
+}
+
+func (h *HealthCheckConfig) validate(path string, fail func(path, format string, args ...any)) {
+	if h.Interval.Duration <= 0 {
+		fail(path+".interval", "must be positive, got %v", h.Interval)
+	}
+
+	if h.Timeout.Duration <= 0 {
+		fail(path+".timeout", "must be positive, got %v", h.Timeout)
+	} else if h.Interval.Duration > 0 && h.Timeout.Duration >= h.Interval.Duration {
+		fail(path+".timeout", "must be shorter than the interval %v, got %v", h.Interval, h.Timeout)
+	}
+
+	if h.Rise < 1 {
+		fail(path+".rise", "must be at least 1, got %d", h.Rise)
+	}
+
+	if h.Fall < 1 {
+		fail(path+".fall", "must be at least 1, got %d", h.Fall)
+	}
+
+	if h.HoldDown.Duration < 0 {
+		fail(path+".holdDown", "must not be negative, got %v", h.HoldDown)
+	}
+
+	for i, code := range h.ExpectedStatuses {
+		if code < 100 || code > 599 {
+			fail(fmt.Sprintf("%s.expectedStatuses[%d]", path, i), "invalid HTTP status code %d", code)
+		}
+	}
+}
+
+func (o *OutlierDetectionConfig) validate(path string, fail func(path, format string, args ...any)) {
+	if o.ErrorRate <= 0 || o.ErrorRate > 1 {
+		fail(path+".errorRate", "must be within (0, 1], got %v", o.ErrorRate)
+	}
+
+	if o.MinRequests < 1 {
+		fail(path+".minRequests", "must be at least 1, got %d", o.MinRequests)
+	}
+
+	if o.Interval.Duration <= 0 {
+		fail(path+".interval", "must be positive, got %v", o.Interval)
+	}
+
+	if o.BaseEjectionTime.Duration <= 0 {
+		fail(path+".baseEjectionTime", "must be positive, got %v", o.BaseEjectionTime)
+	}
+
+	if o.MaxEjectionTime.Duration <= 0 {
+		fail(path+".maxEjectionTime", "must be positive, got %v", o.MaxEjectionTime)
+	} else if o.MaxEjectionTime.Duration < o.BaseEjectionTime.Duration {
+		fail(path+".maxEjectionTime", "must not be less than baseEjectionTime %v, got %v",
+			o.BaseEjectionTime, o.MaxEjectionTime)
+	}
+
+	if o.MaxEjectionPercent < 1 || o.MaxEjectionPercent > 100 {
+		fail(path+".maxEjectionPercent", "must be between 1 and 100, got %d", o.MaxEjectionPercent)
+	}
+}
+
+// ValidateBackendURL checks that rawURL is an absolute http(s) URL with an explicit port,
+// which GenerateServerID needs to derive the server id.
+func ValidateBackendURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q", rawURL)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", rawURL)
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("missing host in %q", rawURL)
+	}
+
+	if u.Port() == "" {
+		return fmt.Errorf("missing port in %q", rawURL)
+	}
+
+	return nil
+}
+
+// validateAddress checks a host:port listen address.
+func validateAddress(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q, expected host:port", addr)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || !validPort(n) {
+		return fmt.Errorf("invalid port in %q", addr)
+	}
+
+	return nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// validHeaderName reports whether name is a non-empty HTTP token (RFC 9110), as required of header names.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		alnum := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+
+		if !alnum && strings.IndexByte("!#$%&'*+-.^_`|~", c) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,203 @@
+package common
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	return path
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// TestLoadConfig_File tests that YAML and JSON files are parsed and unset fields get defaults.
+func TestLoadConfig_File(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "YAML", file: "golift.yaml", content: `
+listeners:
+  - {name: public, address: "127.0.0.1:8080", pool: web}
+pools:
+  - name: web
+    strategy: {name: ring_hash, options: {key: "header:X-User"}}
+    healthCheck: {interval: 1s}
+    backends:
+      - url: http://10.0.0.1:8000
+        weight: 3
+      - url: http://10.0.0.2:8000
+`},
+		{name: "JSON", file: "golift.json", content: `{
+  "listeners": [{"name": "public", "address": "127.0.0.1:8080", "pool": "web"}],
+  "pools": [{
+    "name": "web",
+    "strategy": {"name": "ring_hash", "options": {"key": "header:X-User"}},
+    "healthCheck": {"interval": "1s"},
+    "backends": [{"url": "http://10.0.0.1:8000", "weight": 3}, {"url": "http://10.0.0.2:8000"}]
+  }]
+}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := LoadConfig(writeConfig(t, tt.file, tt.content), discardLogger())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			p := conf.Pools[0]
+			if p.Strategy.Name != "ring_hash" || p.Strategy.Options["key"] != "header:X-User" {
+				t.Errorf("unexpected strategy %+v", p.Strategy)
+			}
+
+			if p.HealthCheck.Interval.Duration != time.Second || p.HealthCheck.Timeout.Duration != 500*time.Millisecond {
+				t.Errorf("expected configured interval and default timeout of half the interval, got %+v", p.HealthCheck)
+			}
+
+			if len(p.Backends) != 2 || p.Backends[0].Weight != 3 || p.Backends[1].Weight != 1 {
+				t.Errorf("unexpected backends %+v", p.Backends)
+			}
+
+			if conf.DemoServers.Count != 0 || conf.Admin.Address != "" {
+				t.Errorf("expected demo servers and admin API to stay disabled, got %+v %+v", conf.DemoServers, conf.Admin)
+			}
+		})
+	}
+}
+
+// TestLoadConfig_Invalid tests that invalid values fail with the path of the offending field.
+func TestLoadConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "Unknown Field",
+			content: "pools:\n  - name: web\n    strategie: {name: p2c}\n",
+			want:    []string{"field strategie not found"},
+		},
+		{
+			name:    "Invalid Duration",
+			content: "pools:\n  - name: web\n    healthCheck: {interval: often}\n",
+			want:    []string{`invalid duration "often"`},
+		},
+		{
+			name: "Field Paths",
+			content: `
+listeners:
+  - {name: public, address: "127.0.0.1:80800", pool: api}
+pools:
+  - name: web
+    healthCheck: {interval: 1s, timeout: 1s, rise: -1, expectedStatuses: [200, 700]}
+    outlierDetection: {errorRate: 1.5}
+    backends:
+      - url: http://10.0.0.1:8000
+      - url: http://10.0.0.2
+        weight: -2
+`,
+			want: []string{
+				`listeners[0].address: invalid port in "127.0.0.1:80800"`,
+				`listeners[0].pool: unknown pool "api"`,
+				"pools[0].healthCheck.timeout: must be shorter than the interval 1s, got 1s",
+				"pools[0].healthCheck.rise: must be at least 1, got -1",
+				"pools[0].healthCheck.expectedStatuses[1]: invalid HTTP status code 700",
+				"pools[0].outlierDetection.errorRate: must be within (0, 1], got 1.5",
+				`pools[0].backends[1].url: missing port in "http://10.0.0.2"`,
+				"pools[0].backends[1].weight: must be between 1 and 256, got -2",
+			},
+		},
+		{
+			name:    "Log",
+			content: "log: {level: verbose, format: logfmt}\npools:\n  - name: web\n",
+			want: []string{
+				`log.level: must be debug, info, warn or error, got "verbose"`,
+				`log.format: must be one of [text json], got "logfmt"`,
+			},
+		},
+		{
+			name:    "Request ID Header",
+			content: "requestId: {header: \"X Request ID\"}\npools:\n  - name: web\n",
+			want:    []string{`requestId.header: invalid header name "X Request ID"`},
+		},
+		{
+			name:    "Tracing",
+			content: "tracing: {endpoint: \"127.0.0.1:4318\", sampleRatio: 2}\npools:\n  - name: web\n",
+			want: []string{
+				`tracing.endpoint: must be an absolute http or https URL, got "127.0.0.1:4318"`,
+				"tracing.sampleRatio: must be within (0, 1], got 2",
+			},
+		},
+		{
+			name:    "Access Log",
+			content: "accessLog: {output: stdout, maxBackups: -2}\npools:\n  - name: web\n",
+			want:    []string{"accessLog.maxBackups: must be at least -1, got -2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, "golift.yaml", tt.content), discardLogger())
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadConfig_EnvOverrides tests that environment variables override defaults and reject invalid values.
+func TestLoadConfig_EnvOverrides(t *testing.T) {
+	t.Setenv("NUM_OF_SERVERS", "3")
+	t.Setenv("STARTING_PORT", "9000")
+	t.Setenv("LOAD_BALANCER_PORT", "8081")
+	t.Setenv("LB_STRATEGY", "p2c")
+	t.Setenv("HEALTH_CHECK_INTERVAL", "1s")
+	t.Setenv("HEALTH_CHECK_TIMEOUT", "500ms")
+
+	conf, err := LoadConfig("", discardLogger())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := conf.Pools[0]
+	if len(p.Backends) != 3 || p.Backends[2].URL != "http://localhost:9002" {
+		t.Errorf("expected backends derived from the demo servers, got %+v", p.Backends)
+	}
+
+	if conf.Listeners[0].Address != "127.0.0.1:8081" {
+		t.Errorf("expected listener address 127.0.0.1:8081, got %s", conf.Listeners[0].Address)
+	}
+
+	if p.Strategy.Name != "p2c" || p.HealthCheck.Interval.Duration != time.Second {
+		t.Errorf("expected overridden strategy and interval, got %+v %+v", p.Strategy, p.HealthCheck)
+	}
+
+	t.Setenv("HEALTH_CHECK_RISE", "twice")
+
+	if _, err := LoadConfig("", discardLogger()); err == nil || !strings.Contains(err.Error(), "HEALTH_CHECK_RISE") {
+		t.Errorf("expected HEALTH_CHECK_RISE error, got %v", err)
+	}
+}
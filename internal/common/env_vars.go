@@ -1,57 +1,247 @@
 package common
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
-// Config holds environment-based configuration parameters
-type Config struct {
-	APIHost          string
-	NumOfServers     int
-	StartingPort     int
-	LoadBalancerPort string
-}
-
-// LoadConfig loads the configuration with defaults.
-func LoadConfig(l *slog.Logger) *Config {
-	config := Config{
-		APIHost:          "127.0.0.1",
-		NumOfServers:     5,
-		StartingPort:     8000,
-		LoadBalancerPort: "8080",
-	}
-
-	requiredVars := []string{"API_HOST", "STARTING_PORT", "LOAD_BALANCER_PORT", "NUM_OF_SERVERS"}
-
-	for _, varName := range requiredVars {
-		value := os.Getenv(varName)
-		if value != "" {
-			switch varName {
-			case "API_HOST":
-				config.APIHost = value
-			case "STARTING_PORT":
-				port, err := strconv.Atoi(value)
-				if err != nil {
-					l.Error("invalid STARTING_PORT", "err", err, "port", port) // Log error & continue
-					continue
-				}
-				config.StartingPort = port
-			case "LOAD_BALANCER_PORT":
-				config.LoadBalancerPort = value
-			case "NUM_OF_SERVERS":
-				num, err := strconv.Atoi(value)
-				if err != nil {
-					l.Error("invalid NUM_OF_SERVERs", "err", err, "srv_cnt", num)
-					continue
-				}
-				config.NumOfServers = num
-			}
-		} else {
-			l.Warn("environment variable is not defined. Using default", "varName", varName)
-		}
-	}
-
-	return &config
+// envOverride is an environment variable that overrides fields of the loaded configuration.
+type envOverride struct {
+	name  string
+	apply func(c *Config, value string) error
+}
+
+// envOverrides lists the supported environment variables. Listener and admin variables apply to the
+// first listener and the admin API, pool variables apply to every pool of the configuration.
+var envOverrides = []envOverride{
+	{"API_HOST", func(c *Config, value string) error {
+		if len(c.Listeners) > 0 {
+			c.Listeners[0].Address = replaceHost(c.Listeners[0].Address, value)
+		}
+
+		c.Admin.Address = replaceHost(c.Admin.Address, value)
+
+		return nil
+	}},
+	{"LOAD_BALANCER_PORT", func(c *Config, value string) error {
+		if len(c.Listeners) > 0 {
+			c.Listeners[0].Address = replacePort(c.Listeners[0].Address, value)
+		}
+
+		return nil
+	}},
+	{"ADMIN_PORT", func(c *Config, value string) error {
+		c.Admin.Address = replacePort(c.Admin.Address, value)
+		return nil
+	}},
+	{"NUM_OF_SERVERS", intEnv(func(c *Config, n int) { c.DemoServers.Count = n })},
+	{"STARTING_PORT", intEnv(func(c *Config, n int) { c.DemoServers.StartingPort = n })},
+	{"SHUTDOWN_TIMEOUT", func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected e.g. \"5s\"", value)
+		}
+
+		c.Shutdown.Timeout.Duration = d
+
+		return nil
+	}},
+	{"LOG_LEVEL", func(c *Config, value string) error {
+		c.Log.Level = value
+		return nil
+	}},
+	{"LOG_FORMAT", func(c *Config, value string) error {
+		c.Log.Format = value
+		return nil
+	}},
+	{"TRACING_ENDPOINT", func(c *Config, value string) error {
+		c.Tracing.Endpoint = value
+		return nil
+	}},
+	{"ACCESS_LOG", func(c *Config, value string) error {
+		c.AccessLog.Output = value
+		return nil
+	}},
+	{"ACCESS_LOG_FORMAT", func(c *Config, value string) error {
+		c.AccessLog.Format = value
+		return nil
+	}},
+	{"LB_STRATEGY", func(c *Config, value string) error {
+		forEachPool(c, func(p *PoolConfig) { p.Strategy.Name = value })
+		return nil
+	}},
+	{"LB_STRATEGY_OPTIONS", func(c *Config, value string) error {
+		opts, err := parseKeyValues(value)
+		if err != nil {
+			return err
+		}
+
+		forEachPool(c, func(p *PoolConfig) { p.Strategy.Options = opts })
+
+		return nil
+	}},
+	{"HEALTH_CHECK_PATH", func(c *Config, value string) error {
+		forEachPool(c, func(p *PoolConfig) { p.HealthCheck.Path = value })
+		return nil
+	}},
+	{"HEALTH_CHECK_INTERVAL", durationEnv(func(p *PoolConfig, d time.Duration) { p.HealthCheck.Interval.Duration = d })},
+	{"HEALTH_CHECK_TIMEOUT", durationEnv(func(p *PoolConfig, d time.Duration) { p.HealthCheck.Timeout.Duration = d })},
+	{"HEALTH_CHECK_EXPECTED_STATUS", func(c *Config, value string) error {
+		codes, err := parseStatusCodes(value)
+		if err != nil {
+			return err
+		}
+
+		forEachPool(c, func(p *PoolConfig) { p.HealthCheck.ExpectedStatuses = codes })
+
+		return nil
+	}},
+	{"HEALTH_CHECK_EXPECTED_BODY", func(c *Config, value string) error {
+		forEachPool(c, func(p *PoolConfig) { p.HealthCheck.ExpectedBody = value })
+		return nil
+	}},
+	{"HEALTH_CHECK_RISE", intEnv(func(c *Config, n int) {
+		forEachPool(c, func(p *PoolConfig) { p.HealthCheck.Rise = n })
+	})},
+	{"HEALTH_CHECK_FALL", intEnv(func(c *Config, n int) {
+		forEachPool(c, func(p *PoolConfig) { p.HealthCheck.Fall = n })
+	})},
+	{"HEALTH_CHECK_HOLD_DOWN", durationEnv(func(p *PoolConfig, d time.Duration) { p.HealthCheck.HoldDown.Duration = d })},
+	{"OUTLIER_ERROR_RATE", func(c *Config, value string) error {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+
+		forEachPool(c, func(p *PoolConfig) { p.OutlierDetection.ErrorRate = rate })
+
+		return nil
+	}},
+	{"OUTLIER_MIN_REQUESTS", intEnv(func(c *Config, n int) {
+		forEachPool(c, func(p *PoolConfig) { p.OutlierDetection.MinRequests = n })
+	})},
+	{"OUTLIER_BASE_EJECTION_TIME", durationEnv(func(p *PoolConfig, d time.Duration) {
+		p.OutlierDetection.BaseEjectionTime.Duration = d
+	})},
+	{"OUTLIER_MAX_EJECTION_PERCENT", intEnv(func(c *Config, n int) {
+		forEachPool(c, func(p *PoolConfig) { p.OutlierDetection.MaxEjectionPercent = n })
+	})},
+}
+
+// applyEnv overrides c with the environment variables that are set. Without a config file the
+// backends are derived from the demo servers, so NUM_OF_SERVERS and STARTING_PORT resize the pool.
+func applyEnv(c *Config, deriveBackends bool, l *slog.Logger) error {
+	var errs []error
+
+	for _, env := range envOverrides {
+		value := os.Getenv(env.name)
+		if value == "" {
+			l.Debug("environment variable is not defined, keeping configured value", "varName", env.name)
+			continue
+		}
+
+		if err := env.apply(c, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", env.name, err))
+		}
+	}
+
+	if deriveBackends && len(c.Pools) > 0 {
+		c.Pools[0].Backends = demoBackends(c.DemoServers)
+		c.ApplyDefaults()
+	}
+
+	return errors.Join(errs...)
+}
+
+// intEnv adapts a setter of an integer field to an envOverride.
+func intEnv(set func(c *Config, n int)) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+
+		set(c, n)
+
+		return nil
+	}
+}
+
+// durationEnv adapts a setter of a duration field of every pool to an envOverride.
+func durationEnv(set func(p *PoolConfig, d time.Duration)) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected e.g. \"5s\"", value)
+		}
+
+		forEachPool(c, func(p *PoolConfig) { set(p, d) })
+
+		return nil
+	}
+}
+
+func forEachPool(c *Config, fn func(p *PoolConfig)) {
+	for i := range c.Pools {
+		fn(&c.Pools[i])
+	}
+}
+
+// replaceHost replaces the host of a host:port address, keeping the port.
+func replaceHost(addr, host string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// replacePort replaces the port of a host:port address, keeping the host.
+func replacePort(addr, port string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// parseStatusCodes parses a comma separated list of HTTP status codes, e.g. "200,204".
+func parseStatusCodes(value string) ([]int, error) {
+	parts := strings.Split(value, ",")
+	codes := make([]int, 0, len(parts))
+
+	for _, part := range parts {
+		code, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q", part)
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// parseKeyValues parses a comma separated list of key=value pairs, e.g. "key=header:X-User,virtual_nodes=200".
+func parseKeyValues(value string) (map[string]string, error) {
+	pairs := make(map[string]string)
+
+	for _, part := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", part)
+		}
+
+		pairs[k] = v
+	}
+
+	return pairs, nil
 }
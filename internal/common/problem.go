@@ -0,0 +1,57 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ashtishad/golift/internal/requestid"
+)
+
+// ProblemContentType is the media type of problem details responses (RFC 9457).
+const ProblemContentType = "application/problem+json"
+
+// Problem is the problem details (RFC 9457) body rendered for an AppError, extended with its
+// machine-readable code and the id of the request. The type is "about:blank", so the title is the status text.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// NewProblem describes appErr as problem details about the request r, which may be nil.
+// Only the message of appErr is exposed, the wrapped cause stays internal.
+func NewProblem(appErr AppError, r *http.Request) Problem {
+	p := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(appErr.Code()),
+		Status: appErr.Code(),
+		Detail: appErr.Error(),
+		Code:   appErr.ErrorCode(),
+	}
+
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = requestid.FromContext(r.Context())
+	}
+
+	return p
+}
+
+// WriteError renders err as a problem details response. Errors that are not an AppError are
+// rendered as an internal server error without exposing their message.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr AppError
+	if !errors.As(err, &appErr) {
+		appErr = NewInternalServerError("internal server error", err)
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(appErr.Code())
+	_ = json.NewEncoder(w).Encode(NewProblem(appErr, r))
+}
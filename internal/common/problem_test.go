@@ -0,0 +1,97 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashtishad/golift/internal/requestid"
+)
+
+// TestWriteError tests that errors are rendered as problem details with their status and error code.
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{name: "Generic Code", err: NewNotFoundError("no such thing"),
+			wantStatus: http.StatusNotFound, wantCode: ErrCodeNotFound, wantDetail: "no such thing"},
+		{name: "Specific Code", err: NewConflictError("already there").WithErrorCode(ErrCodeServerExists),
+			wantStatus: http.StatusConflict, wantCode: ErrCodeServerExists, wantDetail: "already there"},
+		{name: "Cause Hidden", err: NewBadGatewayError("backend request failed", errors.New("dial tcp: refused")),
+			wantStatus: http.StatusBadGateway, wantCode: ErrCodeBadGateway, wantDetail: "backend request failed"},
+		{name: "Plain Error", err: errors.New("secret internals"),
+			wantStatus: http.StatusInternalServerError, wantCode: ErrCodeInternal, wantDetail: "internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			WriteError(rec, httptest.NewRequest(http.MethodGet, "/servers/42", http.NoBody), tt.err)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != ProblemContentType {
+				t.Errorf("expected content type %s, got %s", ProblemContentType, ct)
+			}
+
+			var p Problem
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+
+			want := Problem{Type: "about:blank", Title: http.StatusText(tt.wantStatus), Status: tt.wantStatus,
+				Detail: tt.wantDetail, Instance: "/servers/42", Code: tt.wantCode}
+			if p != want {
+				t.Errorf("expected %+v, got %+v", want, p)
+			}
+		})
+	}
+}
+
+// TestWriteError_RequestID tests that problem details carry the id of the request, so they can be correlated.
+func TestWriteError_RequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req = req.WithContext(requestid.NewContext(req.Context(), "req-1"))
+
+	rec := httptest.NewRecorder()
+	WriteError(rec, req, NewServiceUnavailableError("no server available"))
+
+	var p Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("failed to decode problem: %v", err)
+	}
+
+	if p.RequestID != "req-1" {
+		t.Errorf("expected request id req-1, got %q", p.RequestID)
+	}
+}
+
+// TestError_Unwrap tests that the cause of an AppError stays reachable by errors.Is and errors.As.
+func TestError_Unwrap(t *testing.T) {
+	cause := &fs.PathError{Op: "open", Path: "golift.yaml", Err: fs.ErrNotExist}
+
+	err := NewBadRequestError("unable to read config").Cause(cause)
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected errors.Is to find the cause")
+	}
+
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "golift.yaml" {
+		t.Errorf("expected errors.As to find the path error, got %v", pathErr)
+	}
+
+	var appErr AppError
+	if !errors.As(err, &appErr) || appErr.Code() != http.StatusBadRequest {
+		t.Errorf("expected errors.As to find the AppError")
+	}
+}
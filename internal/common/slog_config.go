@@ -1,18 +1,24 @@
 package common
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"path/filepath"
+
+	"github.com/ashtishad/golift/internal/requestid"
 )
 
+// LogFormats lists the formats accepted by NewLogger.
+var LogFormats = []string{"text", "json"}
+
 // GetSlogConf constructs and returns a pointer to a slog.HandlerOptions struct.
-// This function customizes the log configuration by setting the logging level to debug
-// and stripping the full directory path from the source's filename. The customized options
-// are encapsulated in a slog.HandlerOptions and returned as a pointer.
+// Records below level are dropped, and if addSource is set they carry the file and line
+// of the call site with the full directory path stripped from the filename.
 //
 // Returns:
 //   - *slog.HandlerOptions: Pointer to a slog.HandlerOptions struct containing the logging configurations.
-func GetSlogConf() *slog.HandlerOptions {
+func GetSlogConf(level slog.Leveler, addSource bool) *slog.HandlerOptions {
 	replace := func(groups []string, a slog.Attr) slog.Attr {
 		// Remove the directory from the source's filename.
 		if a.Key == slog.SourceKey {
@@ -28,10 +34,30 @@ func GetSlogConf() *slog.HandlerOptions {
 	}
 
 	handlerOpts := slog.HandlerOptions{
-		AddSource:   true,
-		Level:       slog.LevelDebug,
+		AddSource:   addSource,
+		Level:       level,
 		ReplaceAttr: replace,
 	}
 
 	return &handlerOpts
 }
+
+// NewLogger creates the logger described by conf writing to w. Its level is read from level,
+// which is set to conf.Level, so the level can be changed at runtime. Records logged with the
+// context of a request carry its id.
+func NewLogger(w io.Writer, conf LogConfig, level *slog.LevelVar) (*slog.Logger, error) {
+	if err := level.UnmarshalText([]byte(conf.Level)); err != nil {
+		return nil, fmt.Errorf("log.level: %w", err)
+	}
+
+	opts := GetSlogConf(level, conf.Source)
+
+	switch conf.Format {
+	case "text":
+		return slog.New(requestid.NewLogHandler(slog.NewTextHandler(w, opts))), nil
+	case "json":
+		return slog.New(requestid.NewLogHandler(slog.NewJSONHandler(w, opts))), nil
+	default:
+		return nil, fmt.Errorf("log.format: unknown format %q, expected one of %v", conf.Format, LogFormats)
+	}
+}
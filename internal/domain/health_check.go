@@ -0,0 +1,265 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxProbeBodySize bounds how much of a probe response body is read when matching ExpectedBody.
+const maxProbeBodySize = 64 << 10
+
+// HealthCheckConfig describes how servers are actively probed.
+type HealthCheckConfig struct {
+	Path             string        // Request path probed on every server, e.g. "/healthz".
+	Interval         time.Duration // Time between two consecutive probes of the same server.
+	Timeout          time.Duration // Upper bound for a single probe round trip.
+	ExpectedStatuses []int         // Status codes considered healthy, any 2xx if empty.
+	ExpectedBody     string        // Optional substring the response body must contain.
+}
+
+// DefaultHealthCheckConfig returns the probe settings used when nothing else is configured.
+func DefaultHealthCheckConfig() HealthCheckConfig {
+	return HealthCheckConfig{
+		Path:     "/",
+		Interval: 5 * time.Second,
+		Timeout:  2 * time.Second,
+	}
+}
+
+// HealthCheckObserver is notified about the result of every probe, err is nil if the server was healthy.
+type HealthCheckObserver interface {
+	ObserveHealthCheck(srv Server, err error)
+}
+
+// HealthCheckOption configures optional attributes of a checker created by NewHealthChecker.
+type HealthCheckOption func(*HealthChecker)
+
+// WithHealthCheckObserver reports the result of every probe to o, e.g. to export them as metrics.
+func WithHealthCheckObserver(o HealthCheckObserver) HealthCheckOption {
+	return func(hc *HealthChecker) {
+		hc.observers = append(hc.observers, o)
+	}
+}
+
+// HealthChecker periodically probes every server of a ServerPooler and flips their alive status
+// through the pool. It subscribes to the pool on Start, so servers added or removed later
+// via AddServer/RemoveServer get their probes started or stopped automatically.
+type HealthChecker struct {
+	pool   ServerPooler
+	conf   HealthCheckConfig
+	client *http.Client
+	logger *slog.Logger
+
+	observers []HealthCheckObserver
+
+	subscribe sync.Once
+	mux       sync.Mutex
+	ctx       context.Context               // Non-nil while the checker is running.
+	cancel    context.CancelFunc            // Stops every probe started since the last Start.
+	probes    map[string]context.CancelFunc // Running probes keyed by server id.
+	wg        sync.WaitGroup
+}
+
+// NewHealthChecker creates a checker for the given pool, filling unset config fields with defaults.
+func NewHealthChecker(pool ServerPooler, conf HealthCheckConfig, logger *slog.Logger, opts ...HealthCheckOption) *HealthChecker {
+	def := DefaultHealthCheckConfig()
+	if conf.Path == "" {
+		conf.Path = def.Path
+	}
+
+	if conf.Interval <= 0 {
+		conf.Interval = def.Interval
+	}
+
+	if conf.Timeout <= 0 {
+		conf.Timeout = def.Timeout
+	}
+
+	hc := &HealthChecker{
+		pool:   pool,
+		conf:   conf,
+		client: &http.Client{Timeout: conf.Timeout},
+		logger: logger,
+		probes: make(map[string]context.CancelFunc),
+	}
+
+	for _, opt := range opts {
+		opt(hc)
+	}
+
+	return hc
+}
+
+// Start begins probing every server currently in the pool and every server added afterwards.
+// Probing stops when ctx is canceled or Stop is called. Start does nothing while the checker is running.
+func (hc *HealthChecker) Start(ctx context.Context) {
+	hc.mux.Lock()
+	if hc.ctx != nil && hc.ctx.Err() == nil {
+		hc.mux.Unlock()
+		return
+	}
+
+	// Probes of a context canceled by the caller are gone or about to return.
+	if hc.cancel != nil {
+		hc.cancel()
+	}
+
+	hc.ctx, hc.cancel = context.WithCancel(ctx)
+	hc.probes = make(map[string]context.CancelFunc)
+	hc.mux.Unlock()
+
+	// Subscribe before listing, duplicates are filtered by ServerAdded.
+	hc.subscribe.Do(func() { hc.pool.Subscribe(hc) })
+
+	for _, srv := range hc.pool.ListServers() {
+		hc.ServerAdded(srv)
+	}
+
+	hc.logger.Info("health checker started", "path", hc.conf.Path, "interval", hc.conf.Interval)
+}
+
+// Stop cancels all running probes and waits for them to return.
+func (hc *HealthChecker) Stop() {
+	hc.mux.Lock()
+	if hc.cancel != nil {
+		hc.cancel()
+	}
+
+	hc.ctx, hc.cancel = nil, nil
+	hc.probes = make(map[string]context.CancelFunc)
+	hc.mux.Unlock()
+
+	hc.wg.Wait()
+}
+
+// ServerAdded starts probing srv if the checker is running, implementing PoolObserver.
+func (hc *HealthChecker) ServerAdded(srv Server) {
+	hc.mux.Lock()
+	defer hc.mux.Unlock()
+
+	if hc.ctx == nil || hc.ctx.Err() != nil {
+		return
+	}
+
+	if _, exists := hc.probes[srv.GetID()]; exists {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(hc.ctx)
+	hc.probes[srv.GetID()] = cancel
+
+	hc.wg.Add(1)
+
+	go func() {
+		defer hc.wg.Done()
+		hc.run(ctx, srv)
+	}()
+}
+
+// ServerRemoved stops probing srv, implementing PoolObserver.
+func (hc *HealthChecker) ServerRemoved(srv Server) {
+	hc.mux.Lock()
+	defer hc.mux.Unlock()
+
+	if cancel, exists := hc.probes[srv.GetID()]; exists {
+		cancel()
+		delete(hc.probes, srv.GetID())
+	}
+}
+
+// run probes srv once immediately and then on every interval until ctx is done.
+func (hc *HealthChecker) run(ctx context.Context, srv Server) {
+	ticker := time.NewTicker(hc.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		hc.probe(ctx, srv)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe checks srv and updates its alive status through the pool once the server's
+// rise/fall thresholds report a stable change.
+func (hc *HealthChecker) probe(ctx context.Context, srv Server) {
+	err := hc.Check(ctx, srv)
+	if ctx.Err() != nil {
+		return // Stopped while probing, the result is meaningless.
+	}
+
+	for _, o := range hc.observers {
+		o.ObserveHealthCheck(srv, err)
+	}
+
+	alive, changed := srv.RecordHealthCheck(err == nil)
+	if !changed {
+		return
+	}
+
+	if appErr := hc.pool.UpdateServerStatus(ctx, srv.GetID(), alive); appErr != nil {
+		return
+	}
+
+	if alive {
+		hc.logger.Info("server is healthy again", "srv_id", srv.GetID(), "url", srv.GetURL().String())
+	} else {
+		hc.logger.Warn("server failed health check", "srv_id", srv.GetID(), "url", srv.GetURL().String(), "err", err)
+	}
+}
+
+// Check performs a single probe against srv and returns nil if it is considered healthy.
+func (hc *HealthChecker) Check(ctx context.Context, srv Server) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.conf.Timeout)
+	defer cancel()
+
+	probeURL := srv.GetURL().JoinPath(hc.conf.Path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), http.NoBody)
+	if err != nil {
+		return fmt.Errorf("unable to build probe request: %w", err)
+	}
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("probe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if !hc.statusOK(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if hc.conf.ExpectedBody == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+	if err != nil {
+		return fmt.Errorf("unable to read probe response: %w", err)
+	}
+
+	if !strings.Contains(string(body), hc.conf.ExpectedBody) {
+		return fmt.Errorf("response body does not contain %q", hc.conf.ExpectedBody)
+	}
+
+	return nil
+}
+
+func (hc *HealthChecker) statusOK(code int) bool {
+	if len(hc.conf.ExpectedStatuses) == 0 {
+		return code >= 200 && code < 300
+	}
+
+	return slices.Contains(hc.conf.ExpectedStatuses, code)
+}
@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// TestHealthChecker_Check tests a single probe against different backend responses.
+func TestHealthChecker_Check(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			_, _ = io.WriteString(w, "status: ok")
+		case "/degraded":
+			_, _ = io.WriteString(w, "status: degraded")
+		case "/teapot":
+			w.WriteHeader(http.StatusTeapot)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	srv, err := NewServer(backend.URL)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		conf    HealthCheckConfig
+		wantErr bool
+	}{
+		{name: "2xx by default", conf: HealthCheckConfig{Path: "/healthz"}, wantErr: false},
+		{name: "5xx is unhealthy", conf: HealthCheckConfig{Path: "/down"}, wantErr: true},
+		{name: "expected status", conf: HealthCheckConfig{Path: "/teapot", ExpectedStatuses: []int{http.StatusTeapot}}, wantErr: false},
+		{name: "unexpected status", conf: HealthCheckConfig{Path: "/healthz", ExpectedStatuses: []int{http.StatusNoContent}}, wantErr: true},
+		{name: "body match", conf: HealthCheckConfig{Path: "/healthz", ExpectedBody: "ok"}, wantErr: false},
+		{name: "body mismatch", conf: HealthCheckConfig{Path: "/degraded", ExpectedBody: "ok"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := NewHealthChecker(NewServerPool(&LeastConnection{}, 1, discardLogger()), tt.conf, discardLogger())
+
+			err := hc.Check(context.Background(), srv)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestHealthChecker_FlipsStatus tests that probes mark servers dead and alive through the pool,
+// including servers added after the checker was started.
+func TestHealthChecker_FlipsStatus(t *testing.T) {
+	var healthy atomic.Bool
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	pool := NewServerPool(&LeastConnection{}, 1, discardLogger())
+	hc := NewHealthChecker(pool, HealthCheckConfig{Interval: 5 * time.Millisecond}, discardLogger())
+
+	hc.Start(context.Background())
+	defer hc.Stop()
+
+	srv, err := NewServer(backend.URL)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if appErr := pool.AddServer(context.Background(), srv); appErr != nil {
+		t.Fatalf("failed to add server: %v", appErr)
+	}
+
+	waitFor(t, func() bool { return !srv.IsAlive() }, "server to be marked dead")
+
+	healthy.Store(true)
+	waitFor(t, srv.IsAlive, "server to be marked alive")
+
+	if appErr := pool.RemoveServer(context.Background(), srv.GetID()); appErr != nil {
+		t.Fatalf("failed to remove server: %v", appErr)
+	}
+
+	hc.mux.Lock()
+	probes := len(hc.probes)
+	hc.mux.Unlock()
+
+	if probes != 0 {
+		t.Errorf("expected probe to stop after RemoveServer, %d still running", probes)
+	}
+}
+
+// TestHealthChecker_StartTwice tests that starting a running checker does not start a second set of probes
+// that Stop would not stop.
+func TestHealthChecker_StartTwice(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	// Probes block until the test ends, so the probe in flight is the one Stop has to cancel.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case arrived <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	pool := NewServerPool(&LeastConnection{}, 1, discardLogger())
+
+	srv, err := NewServer(backend.URL)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if appErr := pool.AddServer(context.Background(), srv); appErr != nil {
+		t.Fatalf("failed to add server: %v", appErr)
+	}
+
+	var results atomic.Int64
+	observer := healthCheckObserverFunc(func(Server, error) { results.Add(1) })
+
+	conf := HealthCheckConfig{Interval: time.Hour}
+	hc := NewHealthChecker(pool, conf, discardLogger(), WithHealthCheckObserver(observer))
+	hc.Start(context.Background())
+	hc.Start(context.Background())
+
+	select {
+	case <-arrived:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for the first probe")
+	}
+
+	hc.mux.Lock()
+	probes := len(hc.probes)
+	hc.mux.Unlock()
+
+	if probes != 1 {
+		t.Errorf("expected a single probe after starting twice, got %d", probes)
+	}
+
+	// Stop returns once every probe goroutine has, the canceled probe reports no result.
+	hc.Stop()
+
+	if got := results.Load(); got != 0 {
+		t.Errorf("expected no probe results after Stop, got %d", got)
+	}
+}
+
+type healthCheckObserverFunc func(srv Server, err error)
+
+func (f healthCheckObserverFunc) ObserveHealthCheck(srv Server, err error) {
+	f(srv, err)
+}
+
+func waitFor(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -1,6 +1,9 @@
 package domain
 
-import "sync"
+import (
+	"net/http"
+	"sync"
+)
 
 // LoadBalancer interface defines the method for selecting a server from a list.
 // It abstracts the strategy used to distribute incoming requests among available servers,
@@ -9,6 +12,22 @@ type LoadBalancer interface {
 	SelectServer(servers []Server) Server
 }
 
+// RequestAwareLoadBalancer is implemented by strategies that need the incoming request to pick a server,
+// e.g. to hash on the client IP for session affinity. The pool prefers SelectServerForRequest when a
+// strategy implements it, all other strategies keep ignoring the request.
+type RequestAwareLoadBalancer interface {
+	LoadBalancer
+	SelectServerForRequest(r *http.Request, servers []Server) Server
+}
+
+// MembershipAware is implemented by strategies that precompute state from the pool members, e.g. hash rings.
+// The pool calls Rebuild with all current members whenever servers are added or removed or a server's
+// alive status changes through the pool. Statuses also change without the pool, e.g. when an ejection
+// expires, so implementations should not filter members by status. Rebuild may run concurrently with selection.
+type MembershipAware interface {
+	Rebuild(servers []Server)
+}
+
 type LeastConnection struct {
 	lastSelectedIndex int
 	mux               sync.Mutex
@@ -20,46 +39,109 @@ type LeastConnection struct {
 // 3: If multiple servers share the lowest count, employ Round Robin to assign the request.
 // 4. If no servers are alive or available, return nil.
 func (lc *LeastConnection) SelectServer(servers []Server) Server {
-	minConns := int(^uint(0) >> 1)
-	var candidates []Server
+	return leastLoaded(servers, compareConnections, &lc.mux, &lc.lastSelectedIndex)
+}
+
+type WeightedLeastConnection struct {
+	lastSelectedIndex int
+	mux               sync.Mutex
+}
+
+// SelectServer selects a server based on the weighted least connections strategy with a Round-Robin tiebreaker.
+// It works like LeastConnection but compares GetActiveConnections()/GetWeight(), so a server of weight 4
+// is considered as loaded as a server of weight 1 only once it holds four times the connections.
+// 1: Select servers with the lowest active connections per unit of weight.
+// 2: Directly assign the request to a lone server with the lowest ratio.
+// 3: If multiple servers share the lowest ratio, employ Round Robin to assign the request.
+// 4. If no servers are alive or available, return nil.
+func (wlc *WeightedLeastConnection) SelectServer(servers []Server) Server {
+	return leastLoaded(servers, compareWeightedConnections, &wlc.mux, &wlc.lastSelectedIndex)
+}
+
+type RoundRobin struct {
+	lastSelectedIndex int
+	mux               sync.Mutex
+}
+
+// SelectServer selects the next alive server after the previously selected one, regardless of load.
+// If no servers are alive or available, it returns nil.
+func (rr *RoundRobin) SelectServer(servers []Server) Server {
+	rr.mux.Lock()
+	defer rr.mux.Unlock()
+
+	for i := 0; i < len(servers); i++ {
+		rr.lastSelectedIndex = (rr.lastSelectedIndex + 1) % len(servers)
+		if srv := servers[rr.lastSelectedIndex]; srv.IsAlive() {
+			return srv
+		}
+	}
 
-	// Step 1: Identify servers with the lowest active connections.
+	return nil
+}
+
+type Random struct{}
+
+// SelectServer selects an alive server uniformly at random.
+// If no servers are alive or available, it returns nil.
+func (rnd *Random) SelectServer(servers []Server) Server {
+	if i := pickAlive(servers, -1); i >= 0 {
+		return servers[i]
+	}
+
+	return nil
+}
+
+// leastLoaded implements the least connections strategies without allocating, so it can run on
+// every request. The cmp function orders two servers by load, lastSelectedIndex guarded by mux
+// remembers the Round-Robin position among equally loaded servers.
+func leastLoaded(servers []Server, cmp func(a, b Server) int, mux *sync.Mutex, lastSelectedIndex *int) Server {
+	var least Server
+	ties := 0
+
+	// Step 1: Identify the lowest load and how many servers share it.
 	for _, srv := range servers {
-		if srv.IsAlive() {
-			conn := srv.GetActiveConnections()
-			if conn < minConns {
-				minConns = conn
-				candidates = []Server{srv} // Start a new list with this server
-			} else if conn == minConns {
-				candidates = append(candidates, srv) // Add to the list of candidates
-			}
+		if !srv.IsAlive() {
+			continue
+		}
+
+		switch {
+		case least == nil || cmp(srv, least) < 0:
+			least, ties = srv, 1
+		case cmp(srv, least) == 0:
+			ties++
 		}
 	}
 
-	// Step 2: If only one server has the least connections, return it.
-	if len(candidates) == 1 {
-		return candidates[0]
+	// Step 2: If only one server has the lowest load, return it.
+	// Step 4: If no servers are alive or available, least is still nil.
+	if ties <= 1 {
+		return least
 	}
 
-	// Step 3: If multiple servers have the least connections, use Round-Robin.
-	lc.mux.Lock()
-	defer lc.mux.Unlock()
-	if len(candidates) > 1 {
-		// Increment lastSelectedIndex safely.
-		lc.lastSelectedIndex = (lc.lastSelectedIndex + 1) % len(servers)
-
-		// Find the next server in the candidates slice that matches the index in the full server list.
-		for lc.lastSelectedIndex < len(servers) {
-			for _, candidate := range candidates {
-				if servers[lc.lastSelectedIndex] == candidate {
-					return candidate
-				}
-			}
-
-			lc.lastSelectedIndex = (lc.lastSelectedIndex + 1) % len(servers)
+	// Step 3: If multiple servers share the lowest load, use Round-Robin.
+	mux.Lock()
+	defer mux.Unlock()
+
+	// Find the next equally loaded server after the last selected index in the full server list.
+	for i := 0; i < len(servers); i++ {
+		*lastSelectedIndex = (*lastSelectedIndex + 1) % len(servers)
+
+		if srv := servers[*lastSelectedIndex]; srv.IsAlive() && cmp(srv, least) == 0 {
+			return srv
 		}
 	}
 
-	// Step 4: If no servers are alive or available, return nil.
-	return nil
+	// Loads changed concurrently since step 1, the lowest one found is still a good pick.
+	return least
+}
+
+// compareConnections orders servers by their active connections.
+func compareConnections(a, b Server) int {
+	return a.GetActiveConnections() - b.GetActiveConnections()
+}
+
+// compareWeightedConnections orders servers by active connections per unit of weight,
+// compared by cross multiplication to stay in integers.
+func compareWeightedConnections(a, b Server) int {
+	return a.GetActiveConnections()*b.GetWeight() - b.GetActiveConnections()*a.GetWeight()
 }
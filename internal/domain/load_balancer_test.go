@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"sync"
 	"testing"
+	"time"
 )
 
 // MockServer implements the Server interface for testing purposes.
@@ -12,6 +13,8 @@ type MockServer struct {
 	id                string
 	alive             bool
 	activeConnections int
+	weight            int
+	latency           time.Duration
 	mux               sync.Mutex
 }
 
@@ -128,6 +131,116 @@ func TestLeastConnection_SelectServer(t *testing.T) {
 	}
 }
 
+// TestWeightedLeastConnection_SelectServer tests the WeightedLeastConnection strategy.
+func TestWeightedLeastConnection_SelectServer(t *testing.T) {
+	mockServers := []*MockServer{
+		{id: "server1", alive: true, weight: 1},
+		{id: "server2", alive: true, weight: 4},
+		{id: "server3", alive: true, weight: 2},
+	}
+
+	servers := make([]Server, len(mockServers))
+	for i, mockServer := range mockServers {
+		servers[i] = mockServer
+	}
+
+	wlc := &WeightedLeastConnection{}
+
+	testScenarios := []struct {
+		name              string
+		setup             func()
+		expectedServerIDs []string
+	}{
+		{
+			name: "Capacity Beats Raw Count",
+			setup: func() {
+				// Ratios 2/1, 4/4 and 3/2: the large server wins despite holding the most connections.
+				mockServers[0].activeConnections = 2
+				mockServers[1].activeConnections = 4
+				mockServers[2].activeConnections = 3
+			},
+			expectedServerIDs: []string{"server2"},
+		},
+		{
+			name: "No Servers Available",
+			setup: func() {
+				for _, server := range mockServers {
+					server.alive = false
+				}
+			},
+			expectedServerIDs: []string{""},
+		},
+		{
+			name: "Dead Server Skipped",
+			setup: func() {
+				mockServers[1].alive = false
+				mockServers[0].activeConnections = 1
+				mockServers[2].activeConnections = 3
+			},
+			expectedServerIDs: []string{"server1"},
+		},
+		{
+			name: "Round-Robin On Equal Ratios",
+			setup: func() {
+				// Ratios 1/1, 4/4 and 2/2 are all equal.
+				wlc.lastSelectedIndex = -1
+				mockServers[0].activeConnections = 1
+				mockServers[1].activeConnections = 4
+				mockServers[2].activeConnections = 2
+			},
+			expectedServerIDs: []string{"server1", "server2", "server3", "server1"},
+		},
+	}
+
+	for _, scenario := range testScenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			scenario.setup()
+
+			for i, expectedID := range scenario.expectedServerIDs {
+				selectedServer := wlc.SelectServer(servers)
+				selectedID := ""
+				if selectedServer != nil {
+					selectedID = selectedServer.GetID()
+				}
+				if expectedID != selectedID {
+					t.Errorf("Round %d: Expected server ID %s, got %s", i+1, expectedID, selectedID)
+				}
+			}
+
+			for _, server := range mockServers {
+				server.alive = true
+				server.activeConnections = 0
+			}
+		})
+	}
+}
+
+// TestRoundRobin_SelectServer tests that RoundRobin cycles through alive servers regardless of load.
+func TestRoundRobin_SelectServer(t *testing.T) {
+	mockServers := []*MockServer{
+		{id: "server1", alive: true, activeConnections: 9},
+		{id: "server2", alive: false},
+		{id: "server3", alive: true},
+	}
+
+	servers := make([]Server, len(mockServers))
+	for i, mockServer := range mockServers {
+		servers[i] = mockServer
+	}
+
+	rr := &RoundRobin{lastSelectedIndex: -1}
+	for i, expectedID := range []string{"server1", "server3", "server1", "server3"} {
+		if selectedID := rr.SelectServer(servers).GetID(); selectedID != expectedID {
+			t.Errorf("Round %d: Expected server ID %s, got %s", i+1, expectedID, selectedID)
+		}
+	}
+
+	mockServers[0].alive, mockServers[2].alive = false, false
+	if selectedServer := rr.SelectServer(servers); selectedServer != nil {
+		t.Errorf("Expected no server when none is alive, got %s", selectedServer.GetID())
+	}
+}
+
 func (m *MockServer) Serve(w http.ResponseWriter, r *http.Request) {
 	// TODO implement me
 	panic("implement me")
@@ -160,6 +273,49 @@ func (m *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Simplified for testing.
 }
 
+func (m *MockServer) RecordHealthCheck(success bool) (alive bool, changed bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return success, success != m.alive
+}
+
+func (m *MockServer) GetWeight() int {
+	return max(m.weight, 1)
+}
+
+func (m *MockServer) GetLatency() time.Duration {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.latency
+}
+
+func (m *MockServer) SetHealthThresholds(rise, fall int, holdDown time.Duration) {}
+
+func (m *MockServer) SetStatusOverride(alive *bool) {}
+
+func (m *MockServer) StatusOverride() *bool {
+	return nil
+}
+
+func (m *MockServer) SetWeight(weight int) {
+	m.weight = weight
+}
+
+func (m *MockServer) Eject(d time.Duration) {}
+
+func (m *MockServer) IsEjected() bool {
+	return false
+}
+
+func (m *MockServer) Drain() <-chan struct{} {
+	// TODO implement me
+	panic("implement me")
+}
+
+func (m *MockServer) IsDraining() bool {
+	return false
+}
+
 func (m *MockServer) GetID() string {
 	return m.id
 }
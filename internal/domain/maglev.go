@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sort"
+	"sync/atomic"
+)
+
+// defaultMaglevTableSize is the default lookup table size, a prime well above 100x typical pool sizes.
+const defaultMaglevTableSize = 65537
+
+// maxMaglevTableSize bounds TableSize, a prime so that it is not rounded up further.
+const maxMaglevTableSize = 1048573
+
+// MaglevConfig configures a Maglev strategy.
+type MaglevConfig struct {
+	HashKeyConfig
+	TableSize int // Lookup table size, rounded up to a prime, defaultMaglevTableSize if not positive.
+}
+
+// Maglev implements Google's Maglev consistent hashing: every server fills slots of a fixed
+// size lookup table following its own permutation, giving O(1) selection, an almost perfectly even
+// distribution and minimal disruption when servers join or leave. The table is rebuilt by the pool
+// whenever membership changes and read lock-free during selection. Slots of servers that are dead,
+// ejected or draining are skipped during selection, so they get their keys back as soon as they recover,
+// e.g. when an ejection expires without the pool noticing.
+type Maglev struct {
+	conf  MaglevConfig
+	table atomic.Pointer[[]Server]
+}
+
+// NewMaglev creates a Maglev strategy, the table is populated by the pool via Rebuild.
+// TableSize is capped at maxMaglevTableSize.
+func NewMaglev(conf MaglevConfig) *Maglev {
+	if conf.TableSize <= 0 {
+		conf.TableSize = defaultMaglevTableSize
+	}
+
+	conf.TableSize = nextPrime(min(conf.TableSize, maxMaglevTableSize))
+
+	return &Maglev{conf: conf}
+}
+
+// Rebuild populates the lookup table from all members whatever their status, implementing MembershipAware.
+// Each server takes weight slots per round, so weights shift the share of slots proportionally.
+func (m *Maglev) Rebuild(servers []Server) {
+	members := slices.Clone(servers)
+
+	// Sort by id so the table does not depend on the order servers are passed in.
+	sort.Slice(members, func(i, j int) bool { return members[i].GetID() < members[j].GetID() })
+
+	table := make([]Server, m.conf.TableSize)
+	if len(members) == 0 {
+		m.table.Store(&table)
+		return
+	}
+
+	size := uint64(m.conf.TableSize)
+	offsets := make([]uint64, len(members))
+	skips := make([]uint64, len(members))
+	next := make([]uint64, len(members))
+
+	for i, srv := range members {
+		offsets[i] = hashString("offset:"+srv.GetID()) % size
+		skips[i] = hashString("skip:"+srv.GetID())%(size-1) + 1
+	}
+
+	for filled := 0; ; {
+		for i, srv := range members {
+			for turn := 0; turn < srv.GetWeight(); turn++ {
+				// Claim the next slot of this server's permutation that is still free.
+				slot := (offsets[i] + next[i]*skips[i]) % size
+				for table[slot] != nil {
+					next[i]++
+					slot = (offsets[i] + next[i]*skips[i]) % size
+				}
+
+				table[slot] = srv
+				next[i]++
+				filled++
+
+				if filled == len(table) {
+					m.table.Store(&table)
+					return
+				}
+			}
+		}
+	}
+}
+
+// SelectServer picks a random alive server, requests without a key have no affinity.
+func (m *Maglev) SelectServer(servers []Server) Server {
+	return m.SelectServerForRequest(nil, servers)
+}
+
+// SelectServerForRequest selects a server based on the Maglev strategy.
+// 1: Hash the configured request attribute onto a table slot.
+// 2: Return the slot's server if it is still alive.
+// 3: Otherwise probe the following slots, which spreads the keys of a dead server across the others.
+// 4. If no servers are alive or available, return nil.
+func (m *Maglev) SelectServerForRequest(r *http.Request, servers []Server) Server {
+	tablePtr := m.table.Load()
+	if tablePtr == nil || len(*tablePtr) == 0 {
+		return nil
+	}
+
+	table := *tablePtr
+
+	// Step 1: Hash the request attribute, requests without one start at a random slot.
+	var h uint64
+	if key := m.conf.Key(r); key != "" {
+		h = hashString(key)
+	} else {
+		h = rand.Uint64()
+	}
+
+	slot := h % uint64(len(table))
+
+	// Step 2 and 3: Return the first alive server from the slot on.
+	for k := 0; k < len(table); k++ {
+		srv := table[(slot+uint64(k))%uint64(len(table))]
+		if srv == nil {
+			return nil // Empty table, the pool had no members at the last rebuild.
+		}
+
+		if srv.IsAlive() {
+			return srv
+		}
+	}
+
+	// Step 4: If no servers are alive or available, return nil.
+	return nil
+}
+
+// nextPrime returns the smallest prime greater than or equal to n.
+func nextPrime(n int) int {
+	if n <= 2 {
+		return 2
+	}
+
+	for ; ; n++ {
+		prime := true
+		for d := 2; d*d <= n; d++ {
+			if n%d == 0 {
+				prime = false
+				break
+			}
+		}
+
+		if prime {
+			return n
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func newHashPool(t *testing.T, lb LoadBalancer, n, basePort int) (ServerPooler, []Server) {
+	t.Helper()
+
+	pool := NewServerPool(lb, n, discardLogger())
+	servers := make([]Server, 0, n)
+
+	for i := 0; i < n; i++ {
+		srv, err := NewServer(fmt.Sprintf("http://127.0.0.1:%d", basePort+i))
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		if appErr := pool.AddServer(context.Background(), srv); appErr != nil {
+			t.Fatalf("failed to add server: %v", appErr)
+		}
+
+		servers = append(servers, srv)
+	}
+
+	return pool, servers
+}
+
+// imbalance returns the most loaded server's share of keys relative to a perfectly even share.
+func imbalance(assignment map[string]string, servers int) float64 {
+	owned := make(map[string]int)
+	for _, id := range assignment {
+		owned[id]++
+	}
+
+	most := 0
+	for _, n := range owned {
+		most = max(most, n)
+	}
+
+	return float64(most) / (float64(len(assignment)) / float64(servers))
+}
+
+// TestMaglev_TableBalance tests that every alive server owns an almost equal share of table slots.
+func TestMaglev_TableBalance(t *testing.T) {
+	m := NewMaglev(MaglevConfig{TableSize: 1000})
+	if m.conf.TableSize != 1009 {
+		t.Fatalf("expected table size to be rounded up to the prime 1009, got %d", m.conf.TableSize)
+	}
+
+	_, servers := newHashPool(t, m, 7, 7300)
+
+	slots := make(map[Server]int)
+	for _, srv := range *m.table.Load() {
+		slots[srv]++
+	}
+
+	for _, srv := range servers {
+		if n := slots[srv]; n < 1009/7 || n > 1009/7+1 {
+			t.Errorf("server %s owns %d slots, expected %d or %d", srv.GetID(), n, 1009/7, 1009/7+1)
+		}
+	}
+}
+
+// TestMaglev_SkipsDeadServers tests that keys of a dead or ejected server move to other servers
+// and return once it recovers, also when no rebuild happens in between, e.g. when an ejection expires.
+func TestMaglev_SkipsDeadServers(t *testing.T) {
+	m := NewMaglev(MaglevConfig{HashKeyConfig: HashKeyConfig{Source: HashByHeader, Name: "X-User"}})
+	pool, servers := newHashPool(t, m, 5, 7400)
+
+	before := mapKeys(pool, 1000)
+
+	if appErr := pool.UpdateServerStatus(context.Background(), servers[0].GetID(), false); appErr != nil {
+		t.Fatalf("failed to update server status: %v", appErr)
+	}
+
+	for key, id := range mapKeys(pool, 1000) {
+		if id == servers[0].GetID() {
+			t.Fatalf("key %s still routed to the dead server", key)
+		}
+	}
+
+	// Ejected while dead, the ejection then expires without the pool rebuilding the table.
+	servers[0].Eject(time.Millisecond)
+
+	if appErr := pool.UpdateServerStatus(context.Background(), servers[0].GetID(), true); appErr != nil {
+		t.Fatalf("failed to update server status: %v", appErr)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	after := mapKeys(pool, 1000)
+	for key, id := range before {
+		if after[key] != id {
+			t.Fatalf("expected key %s to return to %s, got %s", key, id, after[key])
+		}
+	}
+}
+
+// TestMaglev_CompareWithRingHash compares balance and disruption of Maglev and ring hash
+// while servers are added to and removed from a serverPool.
+func TestMaglev_CompareWithRingHash(t *testing.T) {
+	const (
+		keys    = 20000
+		servers = 10
+	)
+
+	key := HashKeyConfig{Source: HashByHeader, Name: "X-User"}
+	strategies := []struct {
+		name         string
+		lb           LoadBalancer
+		maxImbalance float64
+	}{
+		{name: "Maglev", lb: NewMaglev(MaglevConfig{HashKeyConfig: key}), maxImbalance: 1.1},
+		{name: "RingHash", lb: NewRingHash(RingHashConfig{HashKeyConfig: key}), maxImbalance: 1.4},
+	}
+
+	for i, strategy := range strategies {
+		t.Run(strategy.name, func(t *testing.T) {
+			pool, members := newHashPool(t, strategy.lb, servers, 7500+i*100)
+			before := mapKeys(pool, keys)
+
+			balance := imbalance(before, servers)
+			if balance > strategy.maxImbalance {
+				t.Errorf("most loaded server holds %.2fx its fair share, expected at most %.2fx", balance, strategy.maxImbalance)
+			}
+
+			extra, err := NewServer(fmt.Sprintf("http://127.0.0.1:%d", 7599+i*100))
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			if appErr := pool.AddServer(context.Background(), extra); appErr != nil {
+				t.Fatalf("failed to add server: %v", appErr)
+			}
+
+			added := remapped(before, mapKeys(pool, keys))
+
+			if appErr := pool.RemoveServer(context.Background(), members[0].GetID()); appErr != nil {
+				t.Fatalf("failed to remove server: %v", appErr)
+			}
+
+			afterRemove := mapKeys(pool, keys)
+			removed := remapped(before, afterRemove)
+
+			// Ideal disruption: 1/11 of keys move to the new server, plus the removed server's 1/10.
+			idealAdd := 1.0 / (servers + 1)
+			if math.Abs(added-idealAdd) > 0.05 {
+				t.Errorf("adding a server remapped %.1f%% of keys, expected about %.1f%%", added*100, idealAdd*100)
+			}
+
+			if removed > idealAdd+1.0/servers+0.05 {
+				t.Errorf("adding and removing a server remapped %.1f%% of keys", removed*100)
+			}
+
+			t.Logf("imbalance %.3fx, remapped after add %.1f%%, after add+remove %.1f%%", balance, added*100, removed*100)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ResponseObserver is notified about the outcome of every request proxied to a server.
+// Transport errors are reported with the status written by the server's reverse proxy:
+// 502 for connection errors, 504 for timeouts and StatusClientClosedRequest for client aborts.
+type ResponseObserver interface {
+	ObserveResponse(srv Server, statusCode int, latency time.Duration)
+}
+
+// OutlierDetectionConfig describes when servers are ejected based on proxied traffic.
+type OutlierDetectionConfig struct {
+	Interval           time.Duration // Window over which error rates are computed.
+	MinRequests        int           // Requests needed within a window before a server can be ejected.
+	ErrorRateThreshold float64       // Fraction of failed requests (0..1] that triggers an ejection.
+	BaseEjectionTime   time.Duration // First ejection duration, doubled on every consecutive ejection.
+	MaxEjectionTime    time.Duration // Upper bound of a single ejection duration.
+	MaxEjectionPercent int           // Upper bound of pool servers ejected at the same time.
+}
+
+// DefaultOutlierDetectionConfig returns the detection settings used when nothing else is configured.
+func DefaultOutlierDetectionConfig() OutlierDetectionConfig {
+	return OutlierDetectionConfig{
+		Interval:           10 * time.Second,
+		MinRequests:        20,
+		ErrorRateThreshold: 0.5,
+		BaseEjectionTime:   30 * time.Second,
+		MaxEjectionTime:    5 * time.Minute,
+		MaxEjectionPercent: 50,
+	}
+}
+
+// OutlierDetector passively watches proxied responses and temporarily ejects servers whose
+// error rate (5xx responses, connection errors and timeouts) exceeds the configured threshold.
+// Ejected servers report IsAlive() == false, so every strategy skips them until the ejection ends.
+type OutlierDetector struct {
+	pool   ServerPooler
+	conf   OutlierDetectionConfig
+	logger *slog.Logger
+
+	mux      sync.Mutex
+	stats    map[string]*outlierStats // Per server counters keyed by server id.
+	ejectMux sync.Mutex               // Serializes ejections so MaxEjectionPercent holds.
+}
+
+type outlierStats struct {
+	windowStart time.Time
+	requests    int
+	failures    int
+	ejections   int // Consecutive ejections, drives the exponential ejection time.
+}
+
+// NewOutlierDetector creates a detector for the given pool, filling unset config fields with defaults.
+// It subscribes to the pool to forget the counters of removed servers.
+func NewOutlierDetector(pool ServerPooler, conf OutlierDetectionConfig, logger *slog.Logger) *OutlierDetector {
+	def := DefaultOutlierDetectionConfig()
+	if conf.Interval <= 0 {
+		conf.Interval = def.Interval
+	}
+
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = def.MinRequests
+	}
+
+	if conf.ErrorRateThreshold <= 0 || conf.ErrorRateThreshold > 1 {
+		conf.ErrorRateThreshold = def.ErrorRateThreshold
+	}
+
+	if conf.BaseEjectionTime <= 0 {
+		conf.BaseEjectionTime = def.BaseEjectionTime
+	}
+
+	if conf.MaxEjectionTime < conf.BaseEjectionTime {
+		conf.MaxEjectionTime = max(def.MaxEjectionTime, conf.BaseEjectionTime)
+	}
+
+	if conf.MaxEjectionPercent <= 0 || conf.MaxEjectionPercent > 100 {
+		conf.MaxEjectionPercent = def.MaxEjectionPercent
+	}
+
+	od := &OutlierDetector{
+		pool:   pool,
+		conf:   conf,
+		logger: logger,
+		stats:  make(map[string]*outlierStats),
+	}
+
+	pool.Subscribe(od)
+
+	return od
+}
+
+// ObserveResponse records the outcome of a proxied request and ejects srv once its error rate
+// within the current window reaches the threshold, implementing ResponseObserver.
+func (od *OutlierDetector) ObserveResponse(srv Server, statusCode int, _ time.Duration) {
+	if statusCode == StatusClientClosedRequest {
+		return
+	}
+
+	now := time.Now()
+
+	od.mux.Lock()
+	st, exists := od.stats[srv.GetID()]
+	if !exists {
+		st = &outlierStats{windowStart: now}
+		od.stats[srv.GetID()] = st
+	}
+
+	// A window without ejection lets the ejection multiplier decay again.
+	if now.Sub(st.windowStart) >= od.conf.Interval {
+		if st.ejections > 0 && !srv.IsEjected() {
+			st.ejections--
+		}
+
+		st.windowStart, st.requests, st.failures = now, 0, 0
+	}
+
+	st.requests++
+	if statusCode >= http.StatusInternalServerError {
+		st.failures++
+	}
+
+	outlier := st.requests >= od.conf.MinRequests &&
+		float64(st.failures)/float64(st.requests) >= od.conf.ErrorRateThreshold
+	od.mux.Unlock()
+
+	if outlier && !srv.IsEjected() {
+		od.eject(srv)
+	}
+}
+
+// eject takes srv out of rotation unless that would exceed MaxEjectionPercent.
+// The pool is never fully ejected, at least one server always stays in rotation.
+func (od *OutlierDetector) eject(srv Server) {
+	od.ejectMux.Lock()
+	defer od.ejectMux.Unlock()
+
+	// Concurrent failing responses may all find srv an outlier, only the first one ejects it.
+	if srv.IsEjected() {
+		return
+	}
+
+	servers := od.pool.ListServers()
+
+	ejected := 0
+	for _, s := range servers {
+		if s.IsEjected() {
+			ejected++
+		}
+	}
+
+	allowed := min(max(len(servers)*od.conf.MaxEjectionPercent/100, 1), len(servers)-1)
+	if ejected >= allowed {
+		od.logger.Warn("outlier not ejected, max ejection percent reached",
+			"srv_id", srv.GetID(), "ejected", ejected, "servers", len(servers))
+		return
+	}
+
+	od.mux.Lock()
+	st, exists := od.stats[srv.GetID()]
+	if !exists {
+		od.mux.Unlock()
+		return // Removed from the pool meanwhile.
+	}
+
+	d := od.conf.BaseEjectionTime << min(st.ejections, 30)
+	if d <= 0 || d > od.conf.MaxEjectionTime {
+		d = od.conf.MaxEjectionTime
+	}
+
+	st.ejections++
+	st.windowStart, st.requests, st.failures = time.Now(), 0, 0
+	od.mux.Unlock()
+
+	srv.Eject(d)
+	od.logger.Warn("server ejected as outlier", "srv_id", srv.GetID(), "url", srv.GetURL().String(), "duration", d)
+}
+
+// ServerAdded implements PoolObserver, counters are created lazily on the first response.
+func (od *OutlierDetector) ServerAdded(Server) {}
+
+// ServerRemoved drops the counters of srv, implementing PoolObserver.
+func (od *OutlierDetector) ServerRemoved(srv Server) {
+	od.mux.Lock()
+	defer od.mux.Unlock()
+
+	delete(od.stats, srv.GetID())
+}
@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, n int) (ServerPooler, []Server) {
+	t.Helper()
+
+	pool := NewServerPool(&LeastConnection{}, n, discardLogger())
+	servers := make([]Server, 0, n)
+
+	for i := 0; i < n; i++ {
+		srv, err := NewServer(fmt.Sprintf("http://127.0.0.1:%d", 7000+i))
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		if appErr := pool.AddServer(context.Background(), srv); appErr != nil {
+			t.Fatalf("failed to add server: %v", appErr)
+		}
+
+		servers = append(servers, srv)
+	}
+
+	return pool, servers
+}
+
+// TestOutlierDetector_Ejects tests that a server exceeding the error rate is ejected and
+// reported as not alive, while a healthy one stays in rotation.
+func TestOutlierDetector_Ejects(t *testing.T) {
+	pool, servers := newTestPool(t, 3)
+	od := NewOutlierDetector(pool, OutlierDetectionConfig{
+		MinRequests:        4,
+		ErrorRateThreshold: 0.5,
+		BaseEjectionTime:   time.Minute,
+	}, discardLogger())
+
+	for i := 0; i < 4; i++ {
+		od.ObserveResponse(servers[0], http.StatusBadGateway, time.Millisecond)
+		od.ObserveResponse(servers[1], http.StatusOK, time.Millisecond)
+	}
+
+	if !servers[0].IsEjected() || servers[0].IsAlive() {
+		t.Errorf("expected failing server to be ejected and not alive")
+	}
+
+	if servers[1].IsEjected() || !servers[1].IsAlive() {
+		t.Errorf("expected healthy server to stay in rotation")
+	}
+}
+
+// TestOutlierDetector_IgnoresClientAborts tests that client aborts are not blamed on the server.
+func TestOutlierDetector_IgnoresClientAborts(t *testing.T) {
+	pool, servers := newTestPool(t, 2)
+	od := NewOutlierDetector(pool, OutlierDetectionConfig{MinRequests: 2}, discardLogger())
+
+	for i := 0; i < 10; i++ {
+		od.ObserveResponse(servers[0], StatusClientClosedRequest, time.Millisecond)
+	}
+
+	if servers[0].IsEjected() {
+		t.Errorf("expected client aborts not to eject the server")
+	}
+}
+
+// TestOutlierDetector_MaxEjectionPercent tests that the cap is honored and the pool is never fully ejected.
+func TestOutlierDetector_MaxEjectionPercent(t *testing.T) {
+	tests := []struct {
+		name       string
+		servers    int
+		percent    int
+		maxEjected int
+	}{
+		{name: "half of four", servers: 4, percent: 50, maxEjected: 2},
+		{name: "at least one", servers: 4, percent: 10, maxEjected: 1},
+		{name: "never the whole pool", servers: 3, percent: 100, maxEjected: 2},
+		{name: "single server", servers: 1, percent: 100, maxEjected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, servers := newTestPool(t, tt.servers)
+			od := NewOutlierDetector(pool, OutlierDetectionConfig{
+				MinRequests:        1,
+				MaxEjectionPercent: tt.percent,
+			}, discardLogger())
+
+			for _, srv := range servers {
+				od.ObserveResponse(srv, http.StatusInternalServerError, time.Millisecond)
+			}
+
+			ejected := 0
+			for _, srv := range servers {
+				if srv.IsEjected() {
+					ejected++
+				}
+			}
+
+			if ejected != tt.maxEjected {
+				t.Errorf("expected %d ejected servers, got %d", tt.maxEjected, ejected)
+			}
+		})
+	}
+}
+
+// TestOutlierDetector_ExponentialEjection tests that consecutive ejections double the ejection time.
+func TestOutlierDetector_ExponentialEjection(t *testing.T) {
+	pool, servers := newTestPool(t, 2)
+	od := NewOutlierDetector(pool, OutlierDetectionConfig{
+		MinRequests:      1,
+		BaseEjectionTime: time.Minute,
+		MaxEjectionTime:  3 * time.Minute,
+	}, discardLogger())
+
+	s, ok := servers[0].(*server)
+	if !ok {
+		t.Fatalf("Failed to assert the type of server to *server")
+	}
+
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		// End the previous ejection so the server can be ejected again.
+		s.Eject(0)
+
+		od.ObserveResponse(servers[0], http.StatusServiceUnavailable, time.Millisecond)
+
+		got := time.Until(time.Unix(0, s.ejectedUntil.Load()))
+
+		if got > want || got < want-time.Second {
+			t.Errorf("expected ejection of about %v, got %v", want, got)
+		}
+	}
+}
+
+// TestOutlierDetector_EjectOnce tests that responses racing to eject the same outlier eject it once,
+// so the ejection time is not doubled for a single outlier event.
+func TestOutlierDetector_EjectOnce(t *testing.T) {
+	pool, servers := newTestPool(t, 3)
+	od := NewOutlierDetector(pool, OutlierDetectionConfig{MinRequests: 100, BaseEjectionTime: time.Minute}, discardLogger())
+
+	od.ObserveResponse(servers[0], http.StatusBadGateway, time.Millisecond)
+
+	// Both callers found the server an outlier before either ejected it.
+	od.eject(servers[0])
+	od.eject(servers[0])
+
+	od.mux.Lock()
+	ejections := od.stats[servers[0].GetID()].ejections
+	od.mux.Unlock()
+
+	if ejections != 1 {
+		t.Errorf("expected a single ejection, got %d", ejections)
+	}
+}
@@ -0,0 +1,65 @@
+package domain
+
+import "math/rand/v2"
+
+// p2cRandomTries bounds how often a random index is drawn before falling back to a scan,
+// which keeps selection fast while only few servers are dead.
+const p2cRandomTries = 3
+
+// PowerOfTwoChoices samples two distinct alive servers at random and picks the one with fewer
+// active connections. It needs no lock and, unlike LeastConnection, does not scan the whole pool,
+// while still avoiding the herding of pure random selection.
+type PowerOfTwoChoices struct{}
+
+// SelectServer selects a server based on the power of two choices strategy.
+// 1: Draw two distinct alive servers at random.
+// 2: If only one server is alive, return it.
+// 3: Return the sampled server with fewer active connections.
+// 4. If no servers are alive or available, return nil.
+func (p *PowerOfTwoChoices) SelectServer(servers []Server) Server {
+	// Step 1: Draw two distinct alive servers at random.
+	i := pickAlive(servers, -1)
+	if i < 0 {
+		// Step 4: If no servers are alive or available, return nil.
+		return nil
+	}
+
+	j := pickAlive(servers, i)
+	if j < 0 {
+		// Step 2: If only one server is alive, return it.
+		return servers[i]
+	}
+
+	// Step 3: Return the less loaded one.
+	if servers[j].GetActiveConnections() < servers[i].GetActiveConnections() {
+		return servers[j]
+	}
+
+	return servers[i]
+}
+
+// pickAlive returns the index of a random alive server other than exclude, or -1 if there is none.
+// It tries a few random draws first and falls back to a scan from a random offset.
+func pickAlive(servers []Server, exclude int) int {
+	n := len(servers)
+	if n == 0 {
+		return -1
+	}
+
+	for try := 0; try < p2cRandomTries; try++ {
+		idx := rand.IntN(n)
+		if idx != exclude && servers[idx].IsAlive() {
+			return idx
+		}
+	}
+
+	offset := rand.IntN(n)
+	for k := 0; k < n; k++ {
+		idx := (offset + k) % n
+		if idx != exclude && servers[idx].IsAlive() {
+			return idx
+		}
+	}
+
+	return -1
+}
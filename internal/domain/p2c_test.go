@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestPowerOfTwoChoices_SelectServer tests the PowerOfTwoChoices strategy.
+func TestPowerOfTwoChoices_SelectServer(t *testing.T) {
+	testScenarios := []struct {
+		name        string
+		mockServers []*MockServer
+		allowedIDs  map[string]bool
+	}{
+		{
+			name: "Two Servers Less Loaded Wins",
+			mockServers: []*MockServer{
+				{id: "server1", alive: true, activeConnections: 5},
+				{id: "server2", alive: true, activeConnections: 1},
+			},
+			allowedIDs: map[string]bool{"server2": true},
+		},
+		{
+			name: "Single Alive Server",
+			mockServers: []*MockServer{
+				{id: "server1", alive: false},
+				{id: "server2", alive: true, activeConnections: 9},
+				{id: "server3", alive: false},
+			},
+			allowedIDs: map[string]bool{"server2": true},
+		},
+		{
+			name: "Most Loaded Never Chosen",
+			mockServers: []*MockServer{
+				{id: "server1", alive: true, activeConnections: 1},
+				{id: "server2", alive: true, activeConnections: 2},
+				{id: "server3", alive: true, activeConnections: 3},
+			},
+			allowedIDs: map[string]bool{"server1": true, "server2": true},
+		},
+		{
+			name: "No Servers Available",
+			mockServers: []*MockServer{
+				{id: "server1", alive: false},
+				{id: "server2", alive: false},
+			},
+			allowedIDs: map[string]bool{"": true},
+		},
+	}
+
+	p2c := &PowerOfTwoChoices{}
+
+	for _, scenario := range testScenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			servers := make([]Server, len(scenario.mockServers))
+			for i, mockServer := range scenario.mockServers {
+				servers[i] = mockServer
+			}
+
+			for i := 0; i < 100; i++ {
+				selectedServer := p2c.SelectServer(servers)
+				selectedID := ""
+				if selectedServer != nil {
+					selectedID = selectedServer.GetID()
+				}
+				if !scenario.allowedIDs[selectedID] {
+					t.Fatalf("Round %d: unexpected server ID %q", i+1, selectedID)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSelectServer compares PowerOfTwoChoices to LeastConnection for growing pools.
+func BenchmarkSelectServer(b *testing.B) {
+	strategies := []struct {
+		name string
+		new  func() LoadBalancer
+	}{
+		{name: "LeastConnection", new: func() LoadBalancer { return &LeastConnection{} }},
+		{name: "P2C", new: func() LoadBalancer { return &PowerOfTwoChoices{} }},
+	}
+
+	for _, size := range []int{10, 100, 1000} {
+		servers := make([]Server, size)
+		for i := range servers {
+			srv, err := NewServer(fmt.Sprintf("http://127.0.0.1:%d", 10000+i))
+			if err != nil {
+				b.Fatalf("failed to create server: %v", err)
+			}
+
+			servers[i] = srv
+		}
+
+		for _, strategy := range strategies {
+			b.Run(fmt.Sprintf("%s/servers=%d", strategy.name, size), func(b *testing.B) {
+				lb := strategy.new()
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if lb.SelectServer(servers) == nil {
+							b.Error("expected a server to be selected")
+						}
+					}
+				})
+			})
+		}
+	}
+}
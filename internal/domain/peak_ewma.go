@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultLatencyDecay is the time constant of the latency EWMA, as used by Finagle and linkerd.
+	defaultLatencyDecay = 10 * time.Second
+
+	// unmeasuredPenalty is the cost of a server with requests in flight but no latency sample yet,
+	// so a new server gets one probing request instead of the whole burst.
+	unmeasuredPenalty = float64(time.Second)
+
+	// failurePenalty is the least latency recorded for a failed response, so a server answering
+	// with fast errors looks slow instead of attracting traffic.
+	failurePenalty = time.Second
+)
+
+// peakEWMA is an exponentially weighted moving average of latency that jumps to new peaks
+// immediately and decays towards zero while no responses are recorded, so slow servers are
+// avoided right away but retried after being idle for a while.
+type peakEWMA struct {
+	mux   sync.Mutex
+	value float64       // Current average in nanoseconds as of stamp.
+	stamp time.Time     // Time of the last observation.
+	decay time.Duration // Time constant of the exponential decay.
+}
+
+func newPeakEWMA(decay time.Duration) *peakEWMA {
+	return &peakEWMA{decay: decay}
+}
+
+// observe records a response latency measured at now, failed responses count as at least failurePenalty.
+func (e *peakEWMA) observe(rtt time.Duration, failed bool, now time.Time) {
+	if failed {
+		rtt = max(rtt, failurePenalty)
+	}
+
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	sample := float64(rtt)
+	w := e.weight(now)
+
+	if sample > e.value {
+		e.value = sample // Peak sensitivity: slow responses count in full at once.
+	} else {
+		e.value = e.value*w + sample*(1-w)
+	}
+
+	e.stamp = now
+}
+
+// get returns the average decayed by the time since the last observation.
+func (e *peakEWMA) get(now time.Time) time.Duration {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	return time.Duration(e.value * e.weight(now))
+}
+
+// weight returns how much of the current value survives until now, the caller must hold the lock.
+func (e *peakEWMA) weight(now time.Time) float64 {
+	if e.stamp.IsZero() {
+		return 0
+	}
+
+	elapsed := max(now.Sub(e.stamp), 0)
+
+	return math.Exp(-float64(elapsed) / float64(e.decay))
+}
+
+// PeakEWMA is a latency aware strategy in the style of Finagle and linkerd: it samples two alive
+// servers like PowerOfTwoChoices and picks the one with the lower cost, where cost is the server's
+// peak EWMA latency multiplied by its active connections plus one. Slow servers thereby receive
+// less traffic even when their connection counts look the same.
+type PeakEWMA struct{}
+
+// SelectServer selects a server based on the peak EWMA strategy.
+// 1: Draw two distinct alive servers at random.
+// 2: If only one server is alive, return it.
+// 3: Return the sampled server with the lower latency * (active connections + 1).
+// 4. If no servers are alive or available, return nil.
+func (p *PeakEWMA) SelectServer(servers []Server) Server {
+	// Step 1: Draw two distinct alive servers at random.
+	i := pickAlive(servers, -1)
+	if i < 0 {
+		// Step 4: If no servers are alive or available, return nil.
+		return nil
+	}
+
+	j := pickAlive(servers, i)
+	if j < 0 {
+		// Step 2: If only one server is alive, return it.
+		return servers[i]
+	}
+
+	// Step 3: Return the cheaper one.
+	if peakEWMACost(servers[j]) < peakEWMACost(servers[i]) {
+		return servers[j]
+	}
+
+	return servers[i]
+}
+
+func peakEWMACost(srv Server) float64 {
+	latency, active := float64(srv.GetLatency()), float64(srv.GetActiveConnections())
+	if latency == 0 && active > 0 {
+		return unmeasuredPenalty + active
+	}
+
+	return latency * (active + 1)
+}
@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPeakEWMA_Average tests peak sensitivity, smoothing and idle decay of the latency average.
+func TestPeakEWMA_Average(t *testing.T) {
+	start := time.Now()
+	e := newPeakEWMA(10 * time.Second)
+
+	if got := e.get(start); got != 0 {
+		t.Fatalf("expected no latency before the first observation, got %v", got)
+	}
+
+	e.observe(100*time.Millisecond, false, start)
+	if got := e.get(start); got != 100*time.Millisecond {
+		t.Fatalf("expected first sample to be taken as is, got %v", got)
+	}
+
+	// A peak is taken over immediately.
+	e.observe(500*time.Millisecond, false, start.Add(time.Second))
+	if got := e.get(start.Add(time.Second)); got != 500*time.Millisecond {
+		t.Fatalf("expected peak to be taken over immediately, got %v", got)
+	}
+
+	// Faster responses only pull the average down gradually.
+	e.observe(10*time.Millisecond, false, start.Add(2*time.Second))
+	got := e.get(start.Add(2 * time.Second))
+	if got <= 400*time.Millisecond || got >= 500*time.Millisecond {
+		t.Fatalf("expected average between 400ms and 500ms after one fast response, got %v", got)
+	}
+
+	// An idle server decays towards zero so it is retried.
+	if idle := e.get(start.Add(time.Minute)); idle >= 5*time.Millisecond {
+		t.Errorf("expected average to decay while idle, got %v", idle)
+	}
+}
+
+// TestPeakEWMA_FailurePenalty tests that fast failures are recorded as slow responses.
+func TestPeakEWMA_FailurePenalty(t *testing.T) {
+	start := time.Now()
+	e := newPeakEWMA(10 * time.Second)
+
+	e.observe(time.Millisecond, true, start)
+	if got := e.get(start); got != failurePenalty {
+		t.Fatalf("expected a fast failure to count as %v, got %v", failurePenalty, got)
+	}
+
+	e.observe(3*time.Second, true, start)
+	if got := e.get(start); got != 3*time.Second {
+		t.Errorf("expected a slow failure to count with its latency, got %v", got)
+	}
+}
+
+// TestPeakEWMA_SelectServer tests that the strategy prefers fast servers and accounts for load.
+func TestPeakEWMA_SelectServer(t *testing.T) {
+	testScenarios := []struct {
+		name        string
+		mockServers []*MockServer
+		expectedID  string
+	}{
+		{
+			name: "Fast Server Preferred",
+			mockServers: []*MockServer{
+				{id: "slow", alive: true, latency: 200 * time.Millisecond},
+				{id: "fast", alive: true, latency: 20 * time.Millisecond},
+			},
+			expectedID: "fast",
+		},
+		{
+			name: "Load Outweighs Latency",
+			mockServers: []*MockServer{
+				{id: "busy", alive: true, latency: 20 * time.Millisecond, activeConnections: 20},
+				{id: "idle", alive: true, latency: 100 * time.Millisecond},
+			},
+			expectedID: "idle",
+		},
+		{
+			name: "Unmeasured Busy Server Penalized",
+			mockServers: []*MockServer{
+				{id: "new", alive: true, activeConnections: 1},
+				{id: "known", alive: true, latency: 50 * time.Millisecond, activeConnections: 2},
+			},
+			expectedID: "known",
+		},
+		{
+			name: "No Servers Available",
+			mockServers: []*MockServer{
+				{id: "server1", alive: false},
+				{id: "server2", alive: false},
+			},
+			expectedID: "",
+		},
+	}
+
+	p := &PeakEWMA{}
+
+	for _, scenario := range testScenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			servers := make([]Server, len(scenario.mockServers))
+			for i, mockServer := range scenario.mockServers {
+				servers[i] = mockServer
+			}
+
+			for i := 0; i < 20; i++ {
+				selectedServer := p.SelectServer(servers)
+				selectedID := ""
+				if selectedServer != nil {
+					selectedID = selectedServer.GetID()
+				}
+				if selectedID != scenario.expectedID {
+					t.Fatalf("Round %d: Expected server ID %s, got %s", i+1, scenario.expectedID, selectedID)
+				}
+			}
+		})
+	}
+}
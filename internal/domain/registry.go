@@ -0,0 +1,193 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultStrategy is the strategy used when none is configured.
+const DefaultStrategy = "least_connection"
+
+// StrategyOptions are the string options a strategy is configured with, e.g. {"key": "header:X-User"}.
+type StrategyOptions map[string]string
+
+// StrategyFactory creates a new LoadBalancer from its options. Every call must return a fresh
+// instance, since strategies carry per pool state such as round-robin positions or hash rings.
+type StrategyFactory func(opts StrategyOptions) (LoadBalancer, error)
+
+var (
+	registryMux sync.RWMutex
+	registry    = map[string]StrategyFactory{
+		"least_connection":          noOptions(func() LoadBalancer { return &LeastConnection{} }),
+		"weighted_least_connection": noOptions(func() LoadBalancer { return &WeightedLeastConnection{} }),
+		"round_robin":               noOptions(func() LoadBalancer { return &RoundRobin{} }),
+		"weighted_round_robin":      noOptions(func() LoadBalancer { return &WeightedRoundRobin{} }),
+		"random":                    noOptions(func() LoadBalancer { return &Random{} }),
+		"p2c":                       noOptions(func() LoadBalancer { return &PowerOfTwoChoices{} }),
+		"peak_ewma":                 noOptions(func() LoadBalancer { return &PeakEWMA{} }),
+		"ring_hash":                 newRingHashStrategy,
+		"maglev":                    newMaglevStrategy,
+	}
+)
+
+// RegisterStrategy makes a strategy selectable by name, e.g. via the LB_STRATEGY env var.
+// Applications embedding the load balancer call it before loading their configuration.
+// It returns an error if the name is empty or already taken.
+func RegisterStrategy(name string, factory StrategyFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("strategy name and factory must not be empty")
+	}
+
+	registryMux.Lock()
+	defer registryMux.Unlock()
+
+	if _, exists := registry[name]; exists {
+		return fmt.Errorf("strategy %q is already registered", name)
+	}
+
+	registry[name] = factory
+
+	return nil
+}
+
+// NewStrategy creates the strategy registered under name, configured with opts.
+// An empty name selects DefaultStrategy.
+func NewStrategy(name string, opts StrategyOptions) (LoadBalancer, error) {
+	if name == "" {
+		name = DefaultStrategy
+	}
+
+	registryMux.RLock()
+	factory, exists := registry[name]
+	registryMux.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown strategy %q, available: %s", name, strings.Join(StrategyNames(), ", "))
+	}
+
+	lb, err := factory(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options for strategy %q: %w", name, err)
+	}
+
+	return lb, nil
+}
+
+// StrategyNames returns the sorted names of all registered strategies.
+func StrategyNames() []string {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// noOptions adapts a constructor of a strategy without options, rejecting any option given.
+func noOptions(newLB func() LoadBalancer) StrategyFactory {
+	return func(opts StrategyOptions) (LoadBalancer, error) {
+		if err := opts.allow(); err != nil {
+			return nil, err
+		}
+
+		return newLB(), nil
+	}
+}
+
+// newRingHashStrategy supports the options "key" (see parseHashKey) and "virtual_nodes".
+func newRingHashStrategy(opts StrategyOptions) (LoadBalancer, error) {
+	if err := opts.allow("key", "virtual_nodes"); err != nil {
+		return nil, err
+	}
+
+	key, err := parseHashKey(opts["key"])
+	if err != nil {
+		return nil, err
+	}
+
+	vnodes, err := opts.intValue("virtual_nodes", maxVirtualNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRingHash(RingHashConfig{HashKeyConfig: key, VirtualNodes: vnodes}), nil
+}
+
+// newMaglevStrategy supports the options "key" (see parseHashKey) and "table_size".
+func newMaglevStrategy(opts StrategyOptions) (LoadBalancer, error) {
+	if err := opts.allow("key", "table_size"); err != nil {
+		return nil, err
+	}
+
+	key, err := parseHashKey(opts["key"])
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := opts.intValue("table_size", maxMaglevTableSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMaglev(MaglevConfig{HashKeyConfig: key, TableSize: size}), nil
+}
+
+// parseHashKey parses "client_ip", "header:<name>", "cookie:<name>" or "path_segment:<index>".
+// An empty value keys on the client IP.
+func parseHashKey(value string) (HashKeyConfig, error) {
+	source, arg, _ := strings.Cut(value, ":")
+
+	switch HashKeySource(source) {
+	case "", HashByClientIP:
+		return HashKeyConfig{Source: HashByClientIP}, nil
+	case HashByHeader, HashByCookie:
+		if arg == "" {
+			return HashKeyConfig{}, fmt.Errorf("key %q needs a name, e.g. %s:X-User", value, source)
+		}
+
+		return HashKeyConfig{Source: HashKeySource(source), Name: arg}, nil
+	case HashByPathSegment:
+		segment, err := strconv.Atoi(arg)
+		if err != nil || segment < 0 {
+			return HashKeyConfig{}, fmt.Errorf("key %q needs a non-negative segment index, e.g. path_segment:1", value)
+		}
+
+		return HashKeyConfig{Source: HashByPathSegment, Segment: segment}, nil
+	default:
+		return HashKeyConfig{}, fmt.Errorf("unknown key source %q", source)
+	}
+}
+
+// allow returns an error naming the first option that is not in allowed.
+func (opts StrategyOptions) allow(allowed ...string) error {
+	for name := range opts {
+		if !slices.Contains(allowed, name) {
+			return fmt.Errorf("unknown option %q", name)
+		}
+	}
+
+	return nil
+}
+
+// intValue parses the named option bounded by limit, returning 0 if it is not set.
+func (opts StrategyOptions) intValue(name string, limit int) (int, error) {
+	value, exists := opts[name]
+	if !exists {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > limit {
+		return 0, fmt.Errorf("option %q must be an integer between 0 and %d, got %q", name, limit, value)
+	}
+
+	return n, nil
+}
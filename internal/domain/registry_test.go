@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"testing"
+)
+
+// TestNewStrategy tests creating the built-in strategies by name.
+func TestNewStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		opts     StrategyOptions
+		wantErr  bool
+	}{
+		{name: "Default", strategy: "", wantErr: false},
+		{name: "Least Connection", strategy: "least_connection", wantErr: false},
+		{name: "Round Robin", strategy: "round_robin", wantErr: false},
+		{name: "Weighted Round Robin", strategy: "weighted_round_robin", wantErr: false},
+		{name: "Random", strategy: "random", wantErr: false},
+		{name: "P2C", strategy: "p2c", wantErr: false},
+		{name: "Ring Hash Header", strategy: "ring_hash", opts: StrategyOptions{"key": "header:X-User", "virtual_nodes": "50"}},
+		{name: "Maglev Path Segment", strategy: "maglev", opts: StrategyOptions{"key": "path_segment:1", "table_size": "1021"}},
+		{name: "Unknown Strategy", strategy: "fastest", wantErr: true},
+		{name: "Option Not Supported", strategy: "round_robin", opts: StrategyOptions{"key": "client_ip"}, wantErr: true},
+		{name: "Header Without Name", strategy: "ring_hash", opts: StrategyOptions{"key": "header"}, wantErr: true},
+		{name: "Unknown Key Source", strategy: "maglev", opts: StrategyOptions{"key": "query:id"}, wantErr: true},
+		{name: "Invalid Integer", strategy: "ring_hash", opts: StrategyOptions{"virtual_nodes": "many"}, wantErr: true},
+		{name: "Too Many Virtual Nodes", strategy: "ring_hash", opts: StrategyOptions{"virtual_nodes": "100000000"}, wantErr: true},
+		{name: "Table Too Large", strategy: "maglev", opts: StrategyOptions{"table_size": "16000000000"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb, err := NewStrategy(tt.strategy, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && lb == nil {
+				t.Errorf("NewStrategy() returned no strategy")
+			}
+		})
+	}
+}
+
+// TestNewStrategy_FreshInstances tests that every call returns a new strategy with its own state.
+func TestNewStrategy_FreshInstances(t *testing.T) {
+	a, err := NewStrategy("round_robin", nil)
+	if err != nil {
+		t.Fatalf("NewStrategy() error = %v", err)
+	}
+
+	b, err := NewStrategy("round_robin", nil)
+	if err != nil {
+		t.Fatalf("NewStrategy() error = %v", err)
+	}
+
+	if a == b {
+		t.Errorf("expected distinct strategy instances")
+	}
+}
+
+// TestRegisterStrategy tests registering a custom strategy and rejecting duplicates.
+func TestRegisterStrategy(t *testing.T) {
+	factory := func(StrategyOptions) (LoadBalancer, error) { return &Random{}, nil }
+
+	if err := RegisterStrategy("test_custom", factory); err != nil {
+		t.Fatalf("RegisterStrategy() error = %v", err)
+	}
+
+	// Registrations are process wide, so repeated runs start without the custom strategy.
+	t.Cleanup(func() {
+		registryMux.Lock()
+		defer registryMux.Unlock()
+
+		delete(registry, "test_custom")
+	})
+
+	if err := RegisterStrategy("test_custom", factory); err == nil {
+		t.Errorf("expected registering a name twice to fail")
+	}
+
+	if err := RegisterStrategy("", factory); err == nil {
+		t.Errorf("expected registering an empty name to fail")
+	}
+
+	if _, err := NewStrategy("test_custom", nil); err != nil {
+		t.Errorf("NewStrategy() error = %v for a registered custom strategy", err)
+	}
+}
@@ -0,0 +1,174 @@
+package domain
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultVirtualNodes is the number of ring points per unit of server weight.
+const defaultVirtualNodes = 160
+
+// maxVirtualNodes bounds VirtualNodes, so a ring holds at most maxVirtualNodes * common.MaxWeight points per server.
+const maxVirtualNodes = 1000
+
+// HashKeySource names the request attribute hashing strategies derive their key from.
+type HashKeySource string
+
+const (
+	HashByClientIP    HashKeySource = "client_ip"    // Host part of the request's remote address.
+	HashByHeader      HashKeySource = "header"       // Value of the header named by HashKeyConfig.Name.
+	HashByCookie      HashKeySource = "cookie"       // Value of the cookie named by HashKeyConfig.Name.
+	HashByPathSegment HashKeySource = "path_segment" // URL path segment at HashKeyConfig.Segment, 0 based.
+)
+
+// HashKeyConfig describes which request attribute a hashing strategy keys on.
+type HashKeyConfig struct {
+	Source  HashKeySource // Attribute to hash, client IP if empty.
+	Name    string        // Header or cookie name for HashByHeader and HashByCookie.
+	Segment int           // Path segment index for HashByPathSegment, e.g. 1 for "/users/{id}".
+}
+
+// Key extracts the hash key from r. Requests lacking the configured attribute fall back to the
+// client IP, so they still stick to one server. It returns "" only if r is nil.
+func (c HashKeyConfig) Key(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	switch c.Source {
+	case HashByHeader:
+		if v := r.Header.Get(c.Name); v != "" {
+			return v
+		}
+	case HashByCookie:
+		if cookie, err := r.Cookie(c.Name); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	case HashByPathSegment:
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if c.Segment >= 0 && c.Segment < len(segments) && segments[c.Segment] != "" {
+			return segments[c.Segment]
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// hashString maps s to a well mixed 64-bit value, FNV-1a followed by the splitmix64 finalizer
+// which spreads the similar short strings used as ring points evenly.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
+
+// RingHashConfig configures a RingHash strategy.
+type RingHashConfig struct {
+	HashKeyConfig
+	VirtualNodes int // Ring points per unit of server weight, defaultVirtualNodes if not positive.
+}
+
+// RingHash provides session affinity without cookies by consistent hashing of a request attribute
+// onto a ring of virtual nodes. Adding or removing one of n servers only remaps about 1/n of the keys.
+// The ring is rebuilt on membership changes and read lock-free during selection.
+type RingHash struct {
+	conf RingHashConfig
+	ring atomic.Pointer[[]ringPoint]
+}
+
+type ringPoint struct {
+	hash uint64
+	srv  Server
+}
+
+// NewRingHash creates a ring hash strategy, the ring is populated by the pool via Rebuild.
+// VirtualNodes is capped at maxVirtualNodes.
+func NewRingHash(conf RingHashConfig) *RingHash {
+	if conf.VirtualNodes <= 0 {
+		conf.VirtualNodes = defaultVirtualNodes
+	}
+
+	conf.VirtualNodes = min(conf.VirtualNodes, maxVirtualNodes)
+
+	return &RingHash{conf: conf}
+}
+
+// Rebuild places VirtualNodes * weight points per server on the ring, implementing MembershipAware.
+// Points are derived from server IDs, so the ring does not depend on the order of servers.
+func (rh *RingHash) Rebuild(servers []Server) {
+	total := 0
+	for _, srv := range servers {
+		total += rh.conf.VirtualNodes * srv.GetWeight()
+	}
+
+	ring := make([]ringPoint, 0, total)
+
+	for _, srv := range servers {
+		points := rh.conf.VirtualNodes * srv.GetWeight()
+		for i := 0; i < points; i++ {
+			ring = append(ring, ringPoint{hash: hashString(srv.GetID() + "#" + strconv.Itoa(i)), srv: srv})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	rh.ring.Store(&ring)
+}
+
+// SelectServer picks a random alive server, requests without a key have no affinity.
+func (rh *RingHash) SelectServer(servers []Server) Server {
+	return rh.SelectServerForRequest(nil, servers)
+}
+
+// SelectServerForRequest selects a server based on the ring hash strategy.
+// 1: Hash the configured request attribute.
+// 2: Find the first ring point clockwise from that hash.
+// 3: Walk on clockwise while the point's server is not alive, so only keys of dead servers move.
+// 4. If no servers are alive or available, return nil.
+func (rh *RingHash) SelectServerForRequest(r *http.Request, servers []Server) Server {
+	ringPtr := rh.ring.Load()
+	if ringPtr == nil || len(*ringPtr) == 0 {
+		return nil
+	}
+
+	ring := *ringPtr
+
+	// Step 1: Hash the request attribute, requests without one start at a random point.
+	var h uint64
+	if key := rh.conf.Key(r); key != "" {
+		h = hashString(key)
+	} else {
+		h = rand.Uint64()
+	}
+
+	// Step 2: Find the first point clockwise.
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+
+	// Step 3: Skip points of servers that are not alive.
+	for k := 0; k < len(ring); k++ {
+		if srv := ring[(start+k)%len(ring)].srv; srv.IsAlive() {
+			return srv
+		}
+	}
+
+	// Step 4: If no servers are alive or available, return nil.
+	return nil
+}
@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHashKeyConfig_Key tests the extraction of hash keys from requests.
+func TestHashKeyConfig_Key(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/42/orders", http.NoBody)
+	req.RemoteAddr = "10.0.0.7:51234"
+	req.Header.Set("X-User", "alice")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s3cr3t"})
+
+	tests := []struct {
+		name string
+		conf HashKeyConfig
+		want string
+	}{
+		{name: "Client IP By Default", conf: HashKeyConfig{}, want: "10.0.0.7"},
+		{name: "Header", conf: HashKeyConfig{Source: HashByHeader, Name: "X-User"}, want: "alice"},
+		{name: "Cookie", conf: HashKeyConfig{Source: HashByCookie, Name: "session"}, want: "s3cr3t"},
+		{name: "Path Segment", conf: HashKeyConfig{Source: HashByPathSegment, Segment: 1}, want: "42"},
+		{name: "Missing Header Falls Back", conf: HashKeyConfig{Source: HashByHeader, Name: "X-Tenant"}, want: "10.0.0.7"},
+		{name: "Missing Segment Falls Back", conf: HashKeyConfig{Source: HashByPathSegment, Segment: 5}, want: "10.0.0.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.conf.Key(req); got != tt.want {
+				t.Errorf("Key() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func requestForKey(key string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.Header.Set("X-User", key)
+
+	return req
+}
+
+// mapKeys records the server ID every key is routed to.
+func mapKeys(pool ServerPooler, keys int) map[string]string {
+	assignment := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		assignment[key] = pool.SelectServer(requestForKey(key)).GetID()
+	}
+
+	return assignment
+}
+
+func remapped(before, after map[string]string) float64 {
+	moved := 0
+	for key, id := range before {
+		if after[key] != id {
+			moved++
+		}
+	}
+
+	return float64(moved) / float64(len(before))
+}
+
+// TestRingHash_Affinity tests that equal keys stick to one server and dead servers are skipped.
+func TestRingHash_Affinity(t *testing.T) {
+	rh := NewRingHash(RingHashConfig{HashKeyConfig: HashKeyConfig{Source: HashByHeader, Name: "X-User"}})
+	pool := NewServerPool(rh, 5, discardLogger())
+
+	for i := 0; i < 5; i++ {
+		srv, err := NewServer(fmt.Sprintf("http://127.0.0.1:%d", 7100+i))
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		if appErr := pool.AddServer(context.Background(), srv); appErr != nil {
+			t.Fatalf("failed to add server: %v", appErr)
+		}
+	}
+
+	first := pool.SelectServer(requestForKey("alice"))
+	for i := 0; i < 10; i++ {
+		if got := pool.SelectServer(requestForKey("alice")); got != first {
+			t.Fatalf("expected key to stick to %s, got %s", first.GetID(), got.GetID())
+		}
+	}
+
+	first.SetAlive(false)
+
+	failover := pool.SelectServer(requestForKey("alice"))
+	if failover == nil || failover == first {
+		t.Fatalf("expected key to fail over to another alive server")
+	}
+
+	first.SetAlive(true)
+
+	if got := pool.SelectServer(requestForKey("alice")); got != first {
+		t.Errorf("expected key to return to %s once alive again", first.GetID())
+	}
+}
+
+// TestRingHash_MinimalDisruption tests that adding or removing one of n servers remaps about 1/n of the keys.
+func TestRingHash_MinimalDisruption(t *testing.T) {
+	const keys = 10000
+
+	rh := NewRingHash(RingHashConfig{HashKeyConfig: HashKeyConfig{Source: HashByHeader, Name: "X-User"}})
+	pool := NewServerPool(rh, 11, discardLogger())
+
+	for i := 0; i < 10; i++ {
+		srv, err := NewServer(fmt.Sprintf("http://127.0.0.1:%d", 7200+i))
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		if appErr := pool.AddServer(context.Background(), srv); appErr != nil {
+			t.Fatalf("failed to add server: %v", appErr)
+		}
+	}
+
+	before := mapKeys(pool, keys)
+
+	// Balance: every server should own roughly a tenth of the keys.
+	owned := make(map[string]int)
+	for _, id := range before {
+		owned[id]++
+	}
+
+	for id, n := range owned {
+		if n < keys/10*6/10 || n > keys/10*14/10 {
+			t.Errorf("server %s owns %d of %d keys, expected about %d", id, n, keys, keys/10)
+		}
+	}
+
+	extra, err := NewServer("http://127.0.0.1:7299")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if appErr := pool.AddServer(context.Background(), extra); appErr != nil {
+		t.Fatalf("failed to add server: %v", appErr)
+	}
+
+	afterAdd := mapKeys(pool, keys)
+	if moved := remapped(before, afterAdd); moved > 0.15 {
+		t.Errorf("adding 1 of 11 servers remapped %.1f%% of keys, expected about 9%%", moved*100)
+	}
+
+	for key, id := range afterAdd {
+		if before[key] != id && id != extra.GetID() {
+			t.Fatalf("key %s moved between two existing servers", key)
+		}
+	}
+
+	if appErr := pool.RemoveServer(context.Background(), extra.GetID()); appErr != nil {
+		t.Fatalf("failed to remove server: %v", appErr)
+	}
+
+	if moved := remapped(before, mapKeys(pool, keys)); moved != 0 {
+		t.Errorf("removing the added server should restore the original mapping, %.1f%% differ", moved*100)
+	}
+}
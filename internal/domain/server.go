@@ -1,48 +1,164 @@
 package domain
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/ashtishad/golift/internal/common"
 )
 
 // Server defines the operations necessary for a server within a load-balanced environment.
 type Server interface {
 	SetAlive(alive bool)                          // Updates the server's alive status.
-	IsAlive() bool                                // Reports the current alive status.
+	IsAlive() bool                                // Reports whether the server is alive and not ejected.
 	GetURL() *url.URL                             // Provides the server's URL.
 	GetActiveConnections() int                    // Returns the current count of active connections.
 	Serve(w http.ResponseWriter, r *http.Request) // Proxies an incoming HTTP request.
 	GetID() string                                // Returns a unique identifier for the server.
 	SetID(srvID string)                           // Sets a unique identifier for the server.
+	GetWeight() int                               // Returns the relative capacity used by weighted strategies.
+	GetLatency() time.Duration                    // Returns the decaying peak EWMA of response latency.
+
+	// RecordHealthCheck feeds a probe result into the rise/fall counters and reports the stable
+	// alive status the server should have, and whether that differs from its current status.
+	RecordHealthCheck(success bool) (alive bool, changed bool)
+
+	// SetStatusOverride pins the status reported by IsAlive, e.g. to take a server out of rotation by hand,
+	// so health checks no longer change it. nil hands the status back to health checks.
+	SetStatusOverride(alive *bool)
+
+	// StatusOverride returns the status pinned via SetStatusOverride, nil if none.
+	StatusOverride() *bool
+
+	// SetHealthThresholds replaces the thresholds set via WithHealthThresholds, keeping the alive status.
+	SetHealthThresholds(rise, fall int, holdDown time.Duration)
+
+	// SetWeight replaces the weight set via WithWeight. Pools apply it via ServerPooler.SetServerWeight,
+	// which also rebuilds strategies depending on weights.
+	SetWeight(weight int)
+
+	// Eject temporarily takes the server out of rotation for d, independent of its alive status.
+	Eject(d time.Duration)
+
+	// IsEjected reports whether the server is currently ejected by outlier detection.
+	IsEjected() bool
+
+	// Drain permanently takes the server out of rotation for new requests and returns a channel
+	// that is closed once its in-flight requests have completed.
+	Drain() <-chan struct{}
+
+	// IsDraining reports whether Drain was called.
+	IsDraining() bool
 }
 
 // server implements the Server interface, representing a backend server.
 type server struct {
 	id           string                 // Unique identifier for the server.
 	url          *url.URL               // URL of the server.
-	alive        bool                   // Indicates whether the server is alive.
-	mux          sync.RWMutex           // Protects access to the server's state.
+	alive        atomic.Bool            // Health checked status, read without locking during selection.
+	mux          sync.Mutex             // Serializes status changes and guards the probe counters below.
 	activeCons   int32                  // Count of active connections, managed atomically.
 	reverseProxy *httputil.ReverseProxy // Used to forward requests to the server.
+	weight       atomic.Int32           // Relative capacity, 1 unless set via WithWeight.
+	latency      *peakEWMA              // Response latency recorded by Serve.
+	logger       *slog.Logger           // Logs proxy errors, slog.Default() unless set via WithLogger.
+
+	rise           int           // Consecutive successful probes needed to become alive.
+	fall           int           // Consecutive failed probes needed to become dead.
+	holdDown       time.Duration // Minimum time between two alive status changes.
+	successes      int           // Current run of successful probes.
+	failures       int           // Current run of failed probes.
+	lastTransition time.Time     // When the alive status last changed.
+	ejectedUntil   atomic.Int64  // Outlier ejection end in unix nanoseconds, 0 if never ejected.
+	override       atomic.Int32  // Status pinned via SetStatusOverride, one of the override constants.
+
+	draining    atomic.Bool   // Set by Drain, the server receives no new requests.
+	drained     chan struct{} // Closed once a draining server has no active connections.
+	drainedOnce sync.Once
+}
+
+// Values of server.override.
+const (
+	overrideNone int32 = iota
+	overrideAlive
+	overrideDead
+)
+
+// ServerOption configures optional attributes of a server created by NewServer.
+type ServerOption func(*server)
+
+// WithHealthThresholds damps health flapping: a dead server needs rise consecutive successful probes
+// to become alive, an alive server needs fall consecutive failed probes to become dead, and no
+// transition happens within holdDown of the previous one. Thresholds below 1 are treated as 1.
+func WithHealthThresholds(rise, fall int, holdDown time.Duration) ServerOption {
+	return func(s *server) {
+		s.rise = max(rise, 1)
+		s.fall = max(fall, 1)
+		s.holdDown = max(holdDown, 0)
+	}
+}
+
+// WithWeight sets the relative capacity of the server, e.g. 4 for a 16-core node next to
+// 4-core nodes of weight 1. Weights below 1 are treated as 1.
+func WithWeight(weight int) ServerOption {
+	return func(s *server) {
+		s.SetWeight(weight)
+	}
+}
+
+// WithLatencyDecay sets how fast recorded latency is forgotten, larger values smooth out more
+// and make an idle server look fast again more slowly. Non-positive values keep the default.
+func WithLatencyDecay(decay time.Duration) ServerOption {
+	return func(s *server) {
+		if decay > 0 {
+			s.latency.decay = decay
+		}
+	}
+}
+
+// WithLogger sets the logger of proxy errors, e.g. one carrying the pool name.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *server) {
+		s.logger = logger
+	}
 }
 
 // NewServer creates a new server instance with the specified URL and reverse proxy.
-func NewServer(rawURL string) (Server, error) {
+func NewServer(rawURL string, opts ...ServerOption) (Server, error) {
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse rawURL: %w", err)
 	}
 
-	return &server{
+	s := &server{
 		url:          parsedURL,
-		alive:        true, // Will use health checks to update.
 		activeCons:   0,
 		reverseProxy: httputil.NewSingleHostReverseProxy(parsedURL),
-	}, nil
+		latency:      newPeakEWMA(defaultLatencyDecay),
+		logger:       slog.Default(),
+		rise:         1,
+		fall:         1,
+		drained:      make(chan struct{}),
+	}
+
+	s.alive.Store(true) // Updated by the HealthChecker.
+	s.weight.Store(1)
+	s.reverseProxy.ErrorHandler = s.handleProxyError
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
 }
 
 // GetID returns the server's unique identifier.
@@ -55,19 +171,149 @@ func (s *server) SetID(srvID string) {
 	s.id = srvID
 }
 
+// GetWeight returns the relative capacity of the server.
+func (s *server) GetWeight() int {
+	return int(s.weight.Load())
+}
+
+// SetWeight changes the relative capacity of the server, weights are clamped to [1, common.MaxWeight].
+func (s *server) SetWeight(weight int) {
+	s.weight.Store(int32(min(max(weight, 1), common.MaxWeight)))
+}
+
+// SetHealthThresholds replaces the rise, fall and hold-down thresholds, keeping the alive status
+// and the current run of probe results.
+func (s *server) SetHealthThresholds(rise, fall int, holdDown time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	WithHealthThresholds(rise, fall, holdDown)(s)
+}
+
+// GetLatency returns the peak EWMA of the server's response latency, decayed by the time since the last response.
+func (s *server) GetLatency() time.Duration {
+	return s.latency.get(time.Now())
+}
+
 // SetAlive updates the server's alive status. It safely handles concurrent updates.
+// An actual status change resets the rise/fall counters and starts a new hold-down period.
 func (s *server) SetAlive(a bool) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	s.alive = a
+
+	if s.alive.Load() != a {
+		s.successes, s.failures = 0, 0
+		s.lastTransition = time.Now()
+	}
+
+	s.alive.Store(a)
 }
 
-// IsAlive returns the current alive status of the server, ensuring thread-safe access.
+// SetStatusOverride pins the status reported by IsAlive to alive, or unpins it if nil. Health checks
+// keep recording probe results meanwhile, so the health checked status applies as soon as it is unpinned.
+func (s *server) SetStatusOverride(alive *bool) {
+	switch {
+	case alive == nil:
+		s.override.Store(overrideNone)
+	case *alive:
+		s.override.Store(overrideAlive)
+	default:
+		s.override.Store(overrideDead)
+	}
+}
+
+// StatusOverride returns the status pinned via SetStatusOverride, nil if none.
+func (s *server) StatusOverride() *bool {
+	var alive bool
+
+	switch s.override.Load() {
+	case overrideAlive:
+		alive = true
+	case overrideDead:
+		alive = false
+	default:
+		return nil
+	}
+
+	return &alive
+}
+
+// RecordHealthCheck counts consecutive probe results and reports the stable alive status.
+// The status only changes once the rise or fall threshold is reached and the hold-down period
+// since the last transition has passed; the caller applies it, e.g. via ServerPooler.UpdateServerStatus.
+func (s *server) RecordHealthCheck(success bool) (alive bool, changed bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if success {
+		s.successes++
+		s.failures = 0
+	} else {
+		s.failures++
+		s.successes = 0
+	}
+
+	alive = s.alive.Load()
+
+	if s.holdDown > 0 && time.Since(s.lastTransition) < s.holdDown {
+		return alive, false
+	}
+
+	switch {
+	case !alive && s.successes >= s.rise:
+		return true, true
+	case alive && s.failures >= s.fall:
+		return false, true
+	default:
+		return alive, false
+	}
+}
+
+// IsAlive returns the current alive status of the server without locking, so selection never blocks.
+// A status pinned via SetStatusOverride takes precedence over health checks. An ejected server is
+// reported as not alive until its ejection ends, a draining server for good.
 func (s *server) IsAlive() bool {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
+	alive := s.alive.Load()
+
+	switch s.override.Load() {
+	case overrideAlive:
+		alive = true
+	case overrideDead:
+		alive = false
+	}
+
+	return alive && !s.IsEjected() && !s.draining.Load()
+}
+
+// Eject takes the server out of rotation for d without touching its health checked alive status.
+func (s *server) Eject(d time.Duration) {
+	s.ejectedUntil.Store(time.Now().Add(d).UnixNano())
+}
+
+// IsEjected reports whether the server is currently ejected by outlier detection.
+// Servers that were never ejected skip reading the clock, keeping selection cheap.
+func (s *server) IsEjected() bool {
+	until := s.ejectedUntil.Load()
+
+	return until != 0 && time.Now().UnixNano() < until
+}
+
+// Drain makes the server report IsAlive() == false, so no strategy selects it anymore, while requests
+// already being served complete. The returned channel is closed once the active connections reach zero.
+// A request selected just before Drain may still start afterwards, so the channel can close slightly early.
+func (s *server) Drain() <-chan struct{} {
+	s.draining.Store(true)
+
+	if s.GetActiveConnections() == 0 {
+		s.drainedOnce.Do(func() { close(s.drained) })
+	}
+
+	return s.drained
+}
 
-	return s.alive
+// IsDraining reports whether the server is draining.
+func (s *server) IsDraining() bool {
+	return s.draining.Load()
 }
 
 // GetURL retrieves the server's URL.
@@ -82,10 +328,60 @@ func (s *server) GetActiveConnections() int {
 }
 
 // Serve forwards the incoming HTTP request to the server using the reverse proxy.
-// It increments and decrements the active connection count before and after serving the request.
+// It increments and decrements the active connection count before and after serving the request,
+// signalling a draining server once its last request completed.
+// The response latency is recorded into the server's peak EWMA, 5xx responses and proxy errors
+// at least as failurePenalty.
 func (s *server) Serve(rw http.ResponseWriter, req *http.Request) {
 	atomic.AddInt32(&s.activeCons, 1)
-	defer atomic.AddInt32(&s.activeCons, -1)
+	defer func() {
+		if atomic.AddInt32(&s.activeCons, -1) == 0 && s.draining.Load() {
+			s.drainedOnce.Do(func() { close(s.drained) })
+		}
+	}()
 
-	s.reverseProxy.ServeHTTP(rw, req)
+	rec := &failureRecorder{ResponseWriter: rw}
+	start := time.Now()
+	s.reverseProxy.ServeHTTP(rec, req)
+	s.latency.observe(time.Since(start), rec.failed, time.Now())
+}
+
+// failureRecorder notes whether a response failed with a 5xx status.
+type failureRecorder struct {
+	http.ResponseWriter
+	failed bool
+}
+
+func (rec *failureRecorder) WriteHeader(code int) {
+	if code >= http.StatusInternalServerError {
+		rec.failed = true
+	}
+
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. for flushing.
+func (rec *failureRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// StatusClientClosedRequest is the non-standard status recorded when the client went away
+// before the server answered, so it is not blamed on the server.
+const StatusClientClosedRequest = 499
+
+// handleProxyError replies with 504 when the server timed out and 502 for any other transport error,
+// rendered as problem details, so response observers can tell failed round trips apart from successful ones.
+func (s *server) handleProxyError(rw http.ResponseWriter, req *http.Request, err error) {
+	s.logger.ErrorContext(req.Context(), "proxy error", "srv_id", s.GetID(), "url", s.url.String(), "path", req.URL.Path, "err", err)
+
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		rw.WriteHeader(StatusClientClosedRequest) // The client is gone, nobody reads a body.
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		common.WriteError(rw, req, common.NewGatewayTimeoutError("backend did not respond in time", err))
+	default:
+		common.WriteError(rw, req, common.NewBadGatewayError("backend request failed", err))
+	}
 }
@@ -1,87 +1,305 @@
 package domain
 
 import (
+	"context"
 	"log/slog"
+	"net/http"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ashtishad/golift/internal/common"
 )
 
 // ServerPooler defines operations for managing a dynamic set of server instances for load balancing.
+// Methods taking a context log with it, so records carry e.g. the request id of an admin API call.
 type ServerPooler interface {
 	// AddServer adds a new server to the pool, generates server id and handling errors like duplicates.
-	AddServer(srv Server) common.AppError
+	AddServer(ctx context.Context, srv Server) common.AppError
+
+	// ReplaceDrainingServer adds srv once the draining server with the same id has been removed, e.g. a backend
+	// configured again while it drains, or at once if there is none. Draining or removing the id cancels it.
+	ReplaceDrainingServer(ctx context.Context, srv Server) common.AppError
 
 	// RemoveServer removes a server by ID, useful for maintenance or decommissioning.
-	RemoveServer(srvID string) common.AppError
+	RemoveServer(ctx context.Context, srvID string) common.AppError
 
 	// GetServer retrieves a server by ID for status checks or updates.
-	GetServer(srvID string) (Server, common.AppError)
+	GetServer(ctx context.Context, srvID string) (Server, common.AppError)
 
 	// ListServers lists all servers, aiding in monitoring and scaling decisions.
 	ListServers() []Server
 
-	// SelectServer picks a server based on the underlying load balancing strategy from LoadBalancer interface.
-	SelectServer() Server
+	// SelectServer picks a server for r based on the underlying load balancing strategy from LoadBalancer interface.
+	// Strategies implementing RequestAwareLoadBalancer receive the request, r may be nil for all others.
+	SelectServer(r *http.Request) Server
 
 	// UpdateServerStatus changes a server's alive status, allowing for dynamic health management.
-	UpdateServerStatus(srvID string, alive bool) common.AppError
+	UpdateServerStatus(ctx context.Context, srvID string, alive bool) common.AppError
+
+	// OverrideServerStatus pins a server's status, so health checks no longer change it, or unpins it if alive is nil.
+	OverrideServerStatus(ctx context.Context, srvID string, alive *bool) common.AppError
+
+	// SetServerWeight changes the weight of a server in place, keeping its status and requests in flight.
+	SetServerWeight(ctx context.Context, srvID string, weight int) common.AppError
+
+	// DrainServer takes a server out of rotation and removes it once its in-flight requests have completed,
+	// or timeout has passed if positive. The returned channel is closed when the server has been removed.
+	DrainServer(ctx context.Context, srvID string, timeout time.Duration) (<-chan struct{}, common.AppError)
+
+	// Subscribe registers an observer that is notified whenever servers join or leave the pool.
+	Subscribe(o PoolObserver)
+
+	// Unsubscribe removes an observer registered with Subscribe, e.g. a replaced health checker.
+	Unsubscribe(o PoolObserver)
+
+	// SetStrategy atomically replaces the load balancing strategy while traffic is flowing.
+	// The name identifies the strategy in logs and on the admin API.
+	SetStrategy(ctx context.Context, name string, strategy LoadBalancer)
+
+	// StrategyName returns the name of the current load balancing strategy.
+	StrategyName() string
 }
 
+// PoolObserver is notified about membership changes of a ServerPooler, e.g. by health checkers
+// that have to start or stop probing a server. Observers are called while the pool is locked,
+// so they must return quickly and must not call back into the pool synchronously.
+type PoolObserver interface {
+	ServerAdded(srv Server)
+	ServerRemoved(srv Server)
+}
+
+// SelectionObserver is notified about every server selection made for a proxied request, e.g. to count
+// selections per strategy. The selected srv is nil if the strategy found no server available.
+type SelectionObserver interface {
+	ObserveSelection(strategy string, srv Server)
+}
+
+// serverPool keeps its servers in a map for lookups by id and publishes an immutable snapshot
+// of them in insertion order, so SelectServer neither locks nor allocates. Writers hold mux and
+// publish a fresh snapshot on every membership change.
 type serverPool struct {
-	servers  map[string]Server
-	mux      sync.RWMutex
-	strategy LoadBalancer
-	logger   *slog.Logger
+	servers   map[string]Server
+	mux       sync.RWMutex
+	snapshot  atomic.Pointer[[]Server]
+	strategy  atomic.Pointer[namedStrategy]
+	logger    *slog.Logger
+	observers []PoolObserver
+	drains    map[string]chan struct{} // Closed when the draining server with the id is removed.
+	pending   map[string]Server        // Added once the draining server with the id is removed.
+}
+
+// namedStrategy pairs a strategy with its name, so both are swapped together.
+type namedStrategy struct {
+	name string
+	lb   LoadBalancer
+}
+
+// ServerPoolOption configures optional attributes of a pool created by NewServerPool.
+type ServerPoolOption func(*serverPool)
+
+// WithStrategyName sets the name of the initial strategy, "custom" if not set.
+func WithStrategyName(name string) ServerPoolOption {
+	return func(sp *serverPool) {
+		sp.strategy.Store(&namedStrategy{name: name, lb: sp.strategy.Load().lb})
+	}
 }
 
 // AddServer adds a new server to the pool, generates server id and handling errors like duplicates.
 // returns an common.AppError if something went wrong.
-func (sp *serverPool) AddServer(srv Server) common.AppError {
+func (sp *serverPool) AddServer(ctx context.Context, srv Server) common.AppError {
 	sp.mux.Lock()
 	defer sp.mux.Unlock()
 
 	// Generate server id with hash value of server URL and port
 	srvID, err := common.GenerateServerID(srv.GetURL().String())
 	if err != nil {
-		sp.logger.Error("failed to generate server id from server URL", "err", err)
-		return common.NewInternalServerError("failed to generate server id from server URL", err)
+		sp.logger.ErrorContext(ctx, "failed to generate server id from server URL", "err", err)
+		return common.NewInternalServerError("failed to generate server id from server URL", err).
+			WithErrorCode(common.ErrCodeInvalidServer)
 	}
 
 	// Check if the server already exists in the pool to avoid duplicates.
 	if _, exists := sp.servers[srvID]; exists {
-		sp.logger.Warn("server ID already exists in the pool", "srv_id", srvID)
-		return common.NewConflictError("server id already exists in the pool")
+		sp.logger.WarnContext(ctx, "server ID already exists in the pool", "srv_id", srvID)
+		return common.NewConflictError("server id already exists in the pool").WithErrorCode(common.ErrCodeServerExists)
+	}
+
+	srv.SetID(srvID)
+	sp.add(srv)
+
+	return nil
+}
+
+// ReplaceDrainingServer adds srv once the draining server with the same id has been removed, or at once if
+// there is none. A later call for the same id replaces srv, DrainServer and RemoveServer of the id cancel it.
+func (sp *serverPool) ReplaceDrainingServer(ctx context.Context, srv Server) common.AppError {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+
+	srvID, err := common.GenerateServerID(srv.GetURL().String())
+	if err != nil {
+		sp.logger.ErrorContext(ctx, "failed to generate server id from server URL", "err", err)
+		return common.NewInternalServerError("failed to generate server id from server URL", err).
+			WithErrorCode(common.ErrCodeInvalidServer)
 	}
 
 	srv.SetID(srvID)
 
-	// Add the server to the pool.
-	sp.servers[srvID] = srv
+	existing, exists := sp.servers[srvID]
+	switch {
+	case !exists:
+		sp.add(srv)
+	case existing.IsDraining():
+		sp.pending[srvID] = srv
+	default:
+		sp.logger.WarnContext(ctx, "server ID already exists in the pool", "srv_id", srvID)
+		return common.NewConflictError("server id already exists in the pool").WithErrorCode(common.ErrCodeServerExists)
+	}
 
 	return nil
 }
 
+// add puts srv into the pool, the caller must hold the lock and have checked its id is not taken.
+func (sp *serverPool) add(srv Server) {
+	sp.servers[srv.GetID()] = srv
+
+	current := sp.list()
+	sp.publish(append(current[:len(current):len(current)], srv))
+
+	for _, o := range sp.observers {
+		o.ServerAdded(srv)
+	}
+}
+
 // RemoveServer removes a server by ID, It returns an common.AppError if the server to be removed does not exist in the pool.
 // Used The `delete` function, safe to call even if the key is not present in the map,
 // However, the existence check is performed to provide specific common.AppError feedback.
-func (sp *serverPool) RemoveServer(srvID string) common.AppError {
+// The server leaves the pool at once, DrainServer lets its requests in flight complete first.
+func (sp *serverPool) RemoveServer(ctx context.Context, srvID string) common.AppError {
 	sp.mux.Lock()
 	defer sp.mux.Unlock()
 
-	if _, exists := sp.servers[srvID]; !exists {
-		sp.logger.Warn("server ID does not exist in the pool", "srv_id", srvID)
-		return common.NewConflictError("server id does not exist in the pool")
+	srv, exists := sp.servers[srvID]
+	if !exists {
+		sp.logger.WarnContext(ctx, "server ID does not exist in the pool", "srv_id", srvID)
+		return common.NewNotFoundError("server id does not exist in the pool").WithErrorCode(common.ErrCodeServerNotFound)
 	}
 
-	delete(sp.servers, srvID)
+	delete(sp.pending, srvID)
+	sp.remove(srv)
 
 	return nil
 }
 
+// remove takes srv out of the pool and ends its drain if any, the caller must hold the lock.
+func (sp *serverPool) remove(srv Server) {
+	srvID := srv.GetID()
+	delete(sp.servers, srvID)
+
+	remaining := make([]Server, 0, len(sp.servers))
+	for _, other := range sp.list() {
+		if other != srv {
+			remaining = append(remaining, other)
+		}
+	}
+
+	sp.publish(remaining)
+
+	for _, o := range sp.observers {
+		o.ServerRemoved(srv)
+	}
+
+	if removed, draining := sp.drains[srvID]; draining {
+		delete(sp.drains, srvID)
+		close(removed)
+	}
+}
+
+// DrainServer marks the server as draining, so no strategy selects it for new requests, and removes it
+// from the pool in the background once its active connections reached zero or timeout passed.
+// A server without requests in flight is removed at once. Draining a server that is already draining
+// returns the channel of the first call.
+func (sp *serverPool) DrainServer(ctx context.Context, srvID string, timeout time.Duration) (<-chan struct{}, common.AppError) {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+
+	srv, exists := sp.servers[srvID]
+	if !exists {
+		sp.logger.ErrorContext(ctx, "server with id not found", "srv_id", srvID)
+		return nil, common.NewNotFoundError("server with id not found").WithErrorCode(common.ErrCodeServerNotFound)
+	}
+
+	delete(sp.pending, srvID)
+
+	if removed, draining := sp.drains[srvID]; draining {
+		return removed, nil
+	}
+
+	removed := make(chan struct{})
+	sp.drains[srvID] = removed
+
+	wasAlive := srv.IsAlive()
+	drained := srv.Drain()
+
+	select {
+	case <-drained:
+		sp.remove(srv)
+		return removed, nil
+	default:
+	}
+
+	if wasAlive {
+		sp.rebuild()
+	}
+
+	sp.logger.InfoContext(ctx, "server draining", "srv_id", srvID, "url", srv.GetURL().String(),
+		"active_connections", srv.GetActiveConnections(), "timeout", timeout)
+
+	// The context only carries log attributes, the drain outlives e.g. the request that started it.
+	go sp.awaitDrain(context.WithoutCancel(ctx), srv, drained, timeout)
+
+	return removed, nil
+}
+
+// awaitDrain removes srv once drained is closed or timeout passed, unless it left the pool meanwhile.
+func (sp *serverPool) awaitDrain(ctx context.Context, srv Server, drained <-chan struct{}, timeout time.Duration) {
+	var deadline <-chan time.Time
+
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		deadline = timer.C
+	}
+
+	select {
+	case <-drained:
+		sp.logger.InfoContext(ctx, "server drained", "srv_id", srv.GetID(), "url", srv.GetURL().String())
+	case <-deadline:
+		sp.logger.WarnContext(ctx, "server drain timed out, removing it with requests in flight", "srv_id", srv.GetID(),
+			"url", srv.GetURL().String(), "active_connections", srv.GetActiveConnections())
+	}
+
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+
+	if sp.servers[srv.GetID()] != srv {
+		return
+	}
+
+	sp.remove(srv)
+
+	if replacement, exists := sp.pending[srv.GetID()]; exists {
+		delete(sp.pending, srv.GetID())
+		sp.add(replacement)
+	}
+}
+
 // GetServer retrieves a server by ID for status checks or updates.
 // It returns the server if found. Returns an common.AppError If the server is not found,
-func (sp *serverPool) GetServer(srvID string) (Server, common.AppError) {
+func (sp *serverPool) GetServer(ctx context.Context, srvID string) (Server, common.AppError) {
 	sp.mux.RLock()
 	defer sp.mux.RUnlock()
 
@@ -90,57 +308,159 @@ func (sp *serverPool) GetServer(srvID string) (Server, common.AppError) {
 	}
 
 	// If the server is not found, return a common.AppError.
-	sp.logger.Error("server with id not found", "srv_id", srvID)
-	return nil, common.NewNotFoundError("server with id not found")
+	sp.logger.ErrorContext(ctx, "server with id not found", "srv_id", srvID)
+	return nil, common.NewNotFoundError("server with id not found").WithErrorCode(common.ErrCodeServerNotFound)
 }
 
-// ListServers lists all servers, returns a slice containing all the servers currently in the pool.
+// ListServers lists all servers, returns a slice containing all the servers currently in the pool
+// in the order they were added.
 func (sp *serverPool) ListServers() []Server {
-	sp.mux.RLock()
-	defer sp.mux.RUnlock()
+	return append([]Server(nil), sp.list()...)
+}
 
-	servers := make([]Server, 0)
+// list returns the published snapshot, which must not be modified.
+func (sp *serverPool) list() []Server {
+	return *sp.snapshot.Load()
+}
+
+// publish makes servers the new snapshot and rebuilds strategies depending on it, the caller must hold the lock.
+func (sp *serverPool) publish(servers []Server) {
+	sp.snapshot.Store(&servers)
+	sp.rebuild()
+}
+
+// rebuild hands the current members to strategies precomputing state from them, the caller must hold the lock.
+func (sp *serverPool) rebuild() {
+	if ma, ok := sp.strategy.Load().lb.(MembershipAware); ok {
+		ma.Rebuild(sp.list())
+	}
+}
+
+// SetStrategy atomically replaces the load balancing strategy while traffic is flowing.
+// Requests already proxied keep running and stay accounted in their server's active connections,
+// new requests are distributed by the new strategy as soon as it is published.
+func (sp *serverPool) SetStrategy(ctx context.Context, name string, strategy LoadBalancer) {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
 
-	for _, srv := range sp.servers {
-		servers = append(servers, srv)
+	// Prepare membership aware strategies before they see their first request.
+	if ma, ok := strategy.(MembershipAware); ok {
+		ma.Rebuild(sp.list())
 	}
 
-	return servers
+	previous := sp.strategy.Swap(&namedStrategy{name: name, lb: strategy})
+	sp.logger.InfoContext(ctx, "load balancing strategy replaced", "from", previous.name, "to", name)
+}
+
+// StrategyName returns the name of the current load balancing strategy.
+func (sp *serverPool) StrategyName() string {
+	return sp.strategy.Load().name
 }
 
 // UpdateServerStatus changes a server's alive status, allowing for dynamic health management.
-func (sp *serverPool) UpdateServerStatus(srvID string, alive bool) common.AppError {
+func (sp *serverPool) UpdateServerStatus(ctx context.Context, srvID string, alive bool) common.AppError {
 	sp.mux.Lock()
 	defer sp.mux.Unlock()
 
 	if srv, exists := sp.servers[srvID]; exists {
 		// If the server is found, update its alive status.
+		wasAlive := srv.IsAlive()
 		srv.SetAlive(alive)
+
+		if wasAlive != srv.IsAlive() {
+			sp.rebuild()
+		}
+
 		return nil
 	}
 
 	// If the server is not found, return a common.AppError.
-	sp.logger.Error("server with id not found", "srv_id", srvID)
-	return common.NewNotFoundError("server with id not found")
+	sp.logger.ErrorContext(ctx, "server with id not found", "srv_id", srvID)
+	return common.NewNotFoundError("server with id not found").WithErrorCode(common.ErrCodeServerNotFound)
 }
 
-// SelectServer picks a server based on the underlying load balancing strategy from LoadBalancer interface.
-func (sp *serverPool) SelectServer() Server {
-	sp.mux.RLock()
-	defer sp.mux.RUnlock()
+// OverrideServerStatus pins a server's status, e.g. set by an operator, or unpins it if alive is nil,
+// handing the status back to health checks.
+func (sp *serverPool) OverrideServerStatus(ctx context.Context, srvID string, alive *bool) common.AppError {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
 
-	serversSlice := make([]Server, 0, len(sp.servers))
-	for _, srv := range sp.servers {
-		serversSlice = append(serversSlice, srv)
+	srv, exists := sp.servers[srvID]
+	if !exists {
+		sp.logger.ErrorContext(ctx, "server with id not found", "srv_id", srvID)
+		return common.NewNotFoundError("server with id not found").WithErrorCode(common.ErrCodeServerNotFound)
 	}
 
-	return sp.strategy.SelectServer(serversSlice)
+	wasAlive := srv.IsAlive()
+	srv.SetStatusOverride(alive)
+
+	if wasAlive != srv.IsAlive() {
+		sp.rebuild()
+	}
+
+	return nil
 }
 
-func NewServerPool(strategy LoadBalancer, cnt int, logger *slog.Logger) ServerPooler {
-	return &serverPool{
-		servers:  make(map[string]Server, cnt),
-		strategy: strategy,
-		logger:   logger,
+// SetServerWeight changes the weight of a server and rebuilds strategies depending on weights.
+func (sp *serverPool) SetServerWeight(ctx context.Context, srvID string, weight int) common.AppError {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+
+	srv, exists := sp.servers[srvID]
+	if !exists {
+		sp.logger.ErrorContext(ctx, "server with id not found", "srv_id", srvID)
+		return common.NewNotFoundError("server with id not found").WithErrorCode(common.ErrCodeServerNotFound)
 	}
+
+	srv.SetWeight(weight)
+	sp.rebuild()
+
+	return nil
+}
+
+// SelectServer picks a server for r based on the underlying load balancing strategy from LoadBalancer interface.
+// It reads the published snapshot without locking or allocating, strategies must not modify the slice.
+func (sp *serverPool) SelectServer(r *http.Request) Server {
+	servers := sp.list()
+
+	strategy := sp.strategy.Load().lb
+	if ra, ok := strategy.(RequestAwareLoadBalancer); ok {
+		return ra.SelectServerForRequest(r, servers)
+	}
+
+	return strategy.SelectServer(servers)
+}
+
+// Subscribe registers an observer that is notified whenever servers join or leave the pool.
+func (sp *serverPool) Subscribe(o PoolObserver) {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+
+	sp.observers = append(sp.observers, o)
+}
+
+// Unsubscribe removes an observer registered with Subscribe, e.g. a replaced health checker.
+func (sp *serverPool) Unsubscribe(o PoolObserver) {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+
+	sp.observers = slices.DeleteFunc(sp.observers, func(other PoolObserver) bool { return other == o })
+}
+
+func NewServerPool(strategy LoadBalancer, cnt int, logger *slog.Logger, opts ...ServerPoolOption) ServerPooler {
+	sp := &serverPool{
+		servers: make(map[string]Server, cnt),
+		logger:  logger,
+		drains:  make(map[string]chan struct{}),
+		pending: make(map[string]Server),
+	}
+
+	sp.snapshot.Store(&[]Server{})
+	sp.strategy.Store(&namedStrategy{name: "custom", lb: strategy})
+
+	for _, opt := range opts {
+		opt(sp)
+	}
+
+	return sp
 }
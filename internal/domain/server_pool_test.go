@@ -0,0 +1,309 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashtishad/golift/internal/common"
+)
+
+// TestServerPool_SetStrategy tests swapping the strategy while requests are being distributed.
+func TestServerPool_SetStrategy(t *testing.T) {
+	pool, servers := newTestPool(t, 4)
+
+	if name := pool.StrategyName(); name != "custom" {
+		t.Errorf("expected unnamed strategy to be reported as custom, got %q", name)
+	}
+
+	var wg sync.WaitGroup
+
+	stop := make(chan struct{})
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					if pool.SelectServer(requestForKey("alice")) == nil {
+						t.Error("expected a server to be selected during the swap")
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for _, name := range []string{"round_robin", "p2c", "ring_hash", "maglev", "least_connection"} {
+		strategy, err := NewStrategy(name, nil)
+		if err != nil {
+			t.Fatalf("NewStrategy() error = %v", err)
+		}
+
+		pool.SetStrategy(context.Background(), name, strategy)
+
+		if got := pool.StrategyName(); got != name {
+			t.Errorf("expected strategy %q, got %q", name, got)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	// Membership aware strategies are prepared with the existing servers before taking traffic.
+	rh := NewRingHash(RingHashConfig{})
+	pool.SetStrategy(context.Background(), "ring_hash", rh)
+
+	if srv := pool.SelectServer(requestForKey("bob")); srv == nil {
+		t.Fatalf("expected the swapped in ring to contain the existing %d servers", len(servers))
+	}
+}
+
+// TestServerPool_Snapshot tests that the pool publishes servers in insertion order and that
+// published snapshots are not modified by later membership changes.
+func TestServerPool_Snapshot(t *testing.T) {
+	pool, servers := newTestPool(t, 4)
+
+	listed := pool.ListServers()
+	for i, srv := range servers {
+		if listed[i] != srv {
+			t.Fatalf("expected server %d in insertion order", i)
+		}
+	}
+
+	// Least connection ties are broken round robin in insertion order.
+	for i := 0; i < 8; i++ {
+		want := servers[(i+1)%len(servers)]
+		if got := pool.SelectServer(nil); got != want {
+			t.Fatalf("Round %d: expected server %d, got %s", i+1, (i+1)%len(servers), got.GetID())
+		}
+	}
+
+	if appErr := pool.RemoveServer(context.Background(), servers[1].GetID()); appErr != nil {
+		t.Fatalf("failed to remove server: %v", appErr)
+	}
+
+	if len(listed) != 4 || listed[1] != servers[1] {
+		t.Errorf("expected a previously listed snapshot to stay unchanged")
+	}
+
+	remaining := pool.ListServers()
+	if len(remaining) != 3 || remaining[0] != servers[0] || remaining[1] != servers[2] || remaining[2] != servers[3] {
+		t.Errorf("expected remaining servers in insertion order")
+	}
+
+	appErr := pool.RemoveServer(context.Background(), servers[1].GetID())
+	if appErr == nil || appErr.Code() != http.StatusNotFound || appErr.ErrorCode() != common.ErrCodeServerNotFound {
+		t.Errorf("expected removing a missing server to fail with 404 server_not_found, got %v", appErr)
+	}
+}
+
+// blockingBackend starts a backend that holds every request until release is closed.
+func blockingBackend(t *testing.T) (rawURL string, started <-chan struct{}, release chan struct{}) {
+	t.Helper()
+
+	startedCh := make(chan struct{}, 10)
+	release = make(chan struct{})
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startedCh <- struct{}{}
+		<-release
+	}))
+	t.Cleanup(backend.Close)
+
+	return backend.URL, startedCh, release
+}
+
+// TestServerPool_DrainServer tests that a draining server gets no new requests, keeps serving the
+// ones in flight and is removed once they completed, or once the timeout passed.
+func TestServerPool_DrainServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		release bool // Whether the request in flight completes before the server is removed.
+	}{
+		{name: "Drained", timeout: 0, release: true},
+		{name: "Timeout", timeout: 50 * time.Millisecond, release: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, servers := newTestPool(t, 1)
+
+			rawURL, started, release := blockingBackend(t)
+			defer close(release)
+
+			srv, err := NewServer(rawURL)
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			if appErr := pool.AddServer(context.Background(), srv); appErr != nil {
+				t.Fatalf("failed to add server: %v", appErr)
+			}
+
+			served := make(chan struct{})
+
+			go func() {
+				defer close(served)
+				srv.Serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+			}()
+			<-started
+
+			removed, appErr := pool.DrainServer(context.Background(), srv.GetID(), tt.timeout)
+			if appErr != nil {
+				t.Fatalf("failed to drain server: %v", appErr)
+			}
+
+			if again, _ := pool.DrainServer(context.Background(), srv.GetID(), tt.timeout); again != removed {
+				t.Errorf("expected draining twice to return the same channel")
+			}
+
+			for i := 0; i < 10; i++ {
+				if got := pool.SelectServer(nil); got != servers[0] {
+					t.Fatalf("expected only the other server to be selected, got %v", got)
+				}
+			}
+
+			if tt.release {
+				select {
+				case <-removed:
+					t.Fatalf("expected server to stay in the pool with a request in flight")
+				case <-time.After(50 * time.Millisecond):
+				}
+
+				release <- struct{}{}
+				<-served
+			}
+
+			select {
+			case <-removed:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("expected server to be removed")
+			}
+
+			if _, appErr := pool.GetServer(context.Background(), srv.GetID()); appErr == nil {
+				t.Errorf("expected drained server to be removed from the pool")
+			}
+		})
+	}
+}
+
+// BenchmarkServerPool_SelectServer reports allocations per request of selecting through the pool,
+// sequentially and from concurrent requests.
+func BenchmarkServerPool_SelectServer(b *testing.B) {
+	for _, size := range []int{10, 100} {
+		pool := NewServerPool(&LeastConnection{}, size, discardLogger())
+
+		for i := 0; i < size; i++ {
+			srv, err := NewServer(fmt.Sprintf("http://127.0.0.1:%d", 11000+i))
+			if err != nil {
+				b.Fatalf("failed to create server: %v", err)
+			}
+
+			if appErr := pool.AddServer(context.Background(), srv); appErr != nil {
+				b.Fatalf("failed to add server: %v", appErr)
+			}
+		}
+
+		b.Run(fmt.Sprintf("servers=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if pool.SelectServer(nil) == nil {
+					b.Fatal("expected a server to be selected")
+				}
+			}
+		})
+
+		// Concurrent selection shows contention on shared state, e.g. locks taken per server.
+		b.Run(fmt.Sprintf("servers=%d/parallel", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if pool.SelectServer(nil) == nil {
+						b.Error("expected a server to be selected")
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// TestServerPool_ReplaceDrainingServer tests that a server configured again while it drains is added
+// once the drain removed the old one, unless the id is drained again meanwhile.
+func TestServerPool_ReplaceDrainingServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		redrain  bool
+		wantKept bool
+	}{
+		{name: "Replaced", wantKept: true},
+		{name: "Drained Again", redrain: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, _ := newTestPool(t, 1)
+
+			rawURL, started, release := blockingBackend(t)
+
+			old, err := NewServer(rawURL)
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			if appErr := pool.AddServer(context.Background(), old); appErr != nil {
+				t.Fatalf("failed to add server: %v", appErr)
+			}
+
+			served := make(chan struct{})
+
+			go func() {
+				defer close(served)
+				old.Serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+			}()
+			<-started
+
+			removed, appErr := pool.DrainServer(context.Background(), old.GetID(), 0)
+			if appErr != nil {
+				t.Fatalf("failed to drain server: %v", appErr)
+			}
+
+			fresh, err := NewServer(rawURL)
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			if appErr := pool.ReplaceDrainingServer(context.Background(), fresh); appErr != nil {
+				t.Fatalf("failed to replace draining server: %v", appErr)
+			}
+
+			if tt.redrain {
+				if _, appErr := pool.DrainServer(context.Background(), old.GetID(), 0); appErr != nil {
+					t.Fatalf("failed to drain server again: %v", appErr)
+				}
+			}
+
+			close(release)
+			<-served
+			<-removed
+
+			got, appErr := pool.GetServer(context.Background(), old.GetID())
+			if kept := appErr == nil && got == fresh; kept != tt.wantKept {
+				t.Errorf("expected replacement in the pool %v, got %v", tt.wantKept, got)
+			}
+		})
+	}
+}
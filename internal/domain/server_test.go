@@ -1,7 +1,13 @@
 package domain
 
 import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestServerAliveStatus tests the SetAlive and IsAlive methods.
@@ -47,7 +53,120 @@ func TestNewServerCreation(t *testing.T) {
 	}
 
 	// Check if the server is initialized with alive = true
-	if !s.alive {
+	if !s.alive.Load() {
 		t.Errorf("NewServer() server should be initialized as alive")
 	}
 }
+
+// TestServerHealthThresholds tests that rise/fall thresholds and hold-down damp status flapping.
+func TestServerHealthThresholds(t *testing.T) {
+	srv, err := NewServer("http://127.0.0.1:5002", WithHealthThresholds(2, 3, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	// Two failures stay below the fall threshold, a success resets the run.
+	for i, success := range []bool{false, false, true, false, false} {
+		if _, changed := srv.RecordHealthCheck(success); changed {
+			t.Fatalf("probe %d: expected no status change below the fall threshold", i+1)
+		}
+	}
+
+	if alive, changed := srv.RecordHealthCheck(false); alive || !changed {
+		t.Fatalf("expected third consecutive failure to report dead, got alive=%v changed=%v", alive, changed)
+	}
+
+	srv.SetAlive(false)
+
+	if _, changed := srv.RecordHealthCheck(true); changed {
+		t.Fatalf("expected a single success to stay below the rise threshold")
+	}
+
+	if alive, changed := srv.RecordHealthCheck(true); !alive || !changed {
+		t.Fatalf("expected second consecutive success to report alive, got alive=%v changed=%v", alive, changed)
+	}
+}
+
+// TestServerHealthHoldDown tests that no transition is reported within the hold-down period.
+func TestServerHealthHoldDown(t *testing.T) {
+	srv, err := NewServer("http://127.0.0.1:5003", WithHealthThresholds(1, 1, time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	srv.SetAlive(false)
+
+	if alive, changed := srv.RecordHealthCheck(true); alive || changed {
+		t.Errorf("expected hold-down to suppress the transition, got alive=%v changed=%v", alive, changed)
+	}
+
+	s, ok := srv.(*server)
+	if !ok {
+		t.Fatalf("Failed to assert the type of server to *server")
+	}
+
+	// Pretend the hold-down period has passed.
+	s.mux.Lock()
+	s.lastTransition = time.Now().Add(-2 * time.Hour)
+	s.mux.Unlock()
+
+	if alive, changed := srv.RecordHealthCheck(true); !alive || !changed {
+		t.Errorf("expected transition after hold-down, got alive=%v changed=%v", alive, changed)
+	}
+}
+
+// TestServerStatusOverride tests that a pinned status holds against health checks until it is unpinned.
+func TestServerStatusOverride(t *testing.T) {
+	srv, err := NewServer("http://127.0.0.1:5004")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	dead := false
+	srv.SetStatusOverride(&dead)
+
+	if srv.IsAlive() {
+		t.Errorf("expected pinned server to be not alive")
+	}
+
+	if got := srv.StatusOverride(); got == nil || *got {
+		t.Errorf("expected override false, got %v", got)
+	}
+
+	// Health checks keep applying their results, but do not change the pinned status.
+	srv.SetAlive(true)
+
+	if srv.IsAlive() {
+		t.Errorf("expected health checks not to revive a pinned server")
+	}
+
+	srv.SetStatusOverride(nil)
+
+	if !srv.IsAlive() || srv.StatusOverride() != nil {
+		t.Errorf("expected unpinned server to report its health checked status")
+	}
+}
+
+// TestServerProxyErrorLogger tests that proxy errors are logged through the logger set via WithLogger.
+func TestServerProxyErrorLogger(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	backend.Close()
+
+	var out bytes.Buffer
+
+	srv, err := NewServer(backend.URL, WithLogger(slog.New(slog.NewTextHandler(&out, nil)).With("pool", "web")))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Serve(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+
+	if !strings.Contains(out.String(), `msg="proxy error" pool=web`) {
+		t.Errorf("expected proxy error logged with the pool, got %q", out.String())
+	}
+}
@@ -0,0 +1,71 @@
+package domain
+
+import "sync"
+
+// WeightedRoundRobin distributes requests proportionally to server weights using the smooth
+// weighted round robin algorithm known from nginx. Unlike plain weighted round robin it interleaves
+// picks, e.g. weights {a: 5, b: 1, c: 1} yield a a b a c a a instead of a a a a a b c.
+type WeightedRoundRobin struct {
+	currentWeights map[Server]int
+	mux            sync.Mutex
+}
+
+// SelectServer selects a server based on the smooth weighted round robin strategy.
+// 1: Raise the current weight of every alive server by its configured weight.
+// 2: Pick the server with the highest current weight, the first one wins ties.
+// 3: Lower the picked server's current weight by the sum of all alive weights.
+// 4. If no servers are alive or available, return nil.
+func (wrr *WeightedRoundRobin) SelectServer(servers []Server) Server {
+	wrr.mux.Lock()
+	defer wrr.mux.Unlock()
+
+	if wrr.currentWeights == nil {
+		wrr.currentWeights = make(map[Server]int, len(servers))
+	}
+
+	var best Server
+	total := 0
+
+	// Step 1 and 2: Raise current weights and find the highest one.
+	for _, srv := range servers {
+		if !srv.IsAlive() {
+			continue
+		}
+
+		weight := srv.GetWeight()
+		total += weight
+		wrr.currentWeights[srv] += weight
+
+		if best == nil || wrr.currentWeights[srv] > wrr.currentWeights[best] {
+			best = srv
+		}
+	}
+
+	// Step 4: If no servers are alive or available, return nil.
+	if best == nil {
+		return nil
+	}
+
+	// Step 3: Lower the winner so the others catch up.
+	wrr.currentWeights[best] -= total
+
+	// Forget servers that left the pool.
+	if len(wrr.currentWeights) > len(servers) {
+		wrr.prune(servers)
+	}
+
+	return best
+}
+
+func (wrr *WeightedRoundRobin) prune(servers []Server) {
+	present := make(map[Server]struct{}, len(servers))
+	for _, srv := range servers {
+		present[srv] = struct{}{}
+	}
+
+	for srv := range wrr.currentWeights {
+		if _, ok := present[srv]; !ok {
+			delete(wrr.currentWeights, srv)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package domain
+
+import "testing"
+
+// TestWeightedRoundRobin_SelectServer tests the smooth weighted round robin strategy.
+func TestWeightedRoundRobin_SelectServer(t *testing.T) {
+	testScenarios := []struct {
+		name              string
+		mockServers       []*MockServer
+		expectedServerIDs []string
+	}{
+		{
+			name: "Smooth Interleaving",
+			mockServers: []*MockServer{
+				{id: "server1", alive: true, weight: 5},
+				{id: "server2", alive: true, weight: 1},
+				{id: "server3", alive: true, weight: 1},
+			},
+			expectedServerIDs: []string{"server1", "server1", "server2", "server1", "server3", "server1", "server1"},
+		},
+		{
+			name: "Equal Weights Cycle",
+			mockServers: []*MockServer{
+				{id: "server1", alive: true, weight: 1},
+				{id: "server2", alive: true, weight: 1},
+				{id: "server3", alive: true, weight: 1},
+			},
+			expectedServerIDs: []string{"server1", "server2", "server3", "server1", "server2", "server3"},
+		},
+		{
+			name: "Dead Servers Skipped",
+			mockServers: []*MockServer{
+				{id: "server1", alive: false, weight: 4},
+				{id: "server2", alive: true, weight: 1},
+				{id: "server3", alive: true, weight: 2},
+			},
+			expectedServerIDs: []string{"server3", "server2", "server3", "server3", "server2", "server3"},
+		},
+		{
+			name: "No Servers Available",
+			mockServers: []*MockServer{
+				{id: "server1", alive: false, weight: 1},
+				{id: "server2", alive: false, weight: 1},
+			},
+			expectedServerIDs: []string{"", ""},
+		},
+	}
+
+	for _, scenario := range testScenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			servers := make([]Server, len(scenario.mockServers))
+			for i, mockServer := range scenario.mockServers {
+				servers[i] = mockServer
+			}
+
+			wrr := &WeightedRoundRobin{}
+
+			for i, expectedID := range scenario.expectedServerIDs {
+				selectedServer := wrr.SelectServer(servers)
+				selectedID := ""
+				if selectedServer != nil {
+					selectedID = selectedServer.GetID()
+				}
+				if expectedID != selectedID {
+					t.Errorf("Round %d: Expected server ID %s, got %s", i+1, expectedID, selectedID)
+				}
+			}
+		})
+	}
+}
+
+// TestWeightedRoundRobin_Distribution tests that picks are proportional to weights over a full cycle.
+func TestWeightedRoundRobin_Distribution(t *testing.T) {
+	mockServers := []*MockServer{
+		{id: "small1", alive: true, weight: 1},
+		{id: "small2", alive: true, weight: 1},
+		{id: "large", alive: true, weight: 4},
+	}
+
+	servers := make([]Server, len(mockServers))
+	for i, mockServer := range mockServers {
+		servers[i] = mockServer
+	}
+
+	wrr := &WeightedRoundRobin{}
+	counts := make(map[string]int)
+
+	for i := 0; i < 600; i++ {
+		counts[wrr.SelectServer(servers).GetID()]++
+	}
+
+	expected := map[string]int{"small1": 100, "small2": 100, "large": 400}
+	for id, want := range expected {
+		if counts[id] != want {
+			t.Errorf("server %s: expected %d picks, got %d", id, want, counts[id])
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashtishad/golift/internal/domain"
+)
+
+// ContentType is the media type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Pools resolves the pools whose metrics are rendered, in the order they are rendered.
+type Pools interface {
+	PoolNames() []string
+	Pool(name string) (domain.ServerPooler, bool)
+}
+
+// label is a single name="value" pair of a sample.
+type label struct {
+	name, value string
+}
+
+// serverSample is a server of a pool together with the counters recorded for it.
+type serverSample struct {
+	labels []label // pool, server_id and url.
+	srv    domain.Server
+	stats  *serverStats // Nil if nothing was recorded for the server yet.
+}
+
+// poolSample is a pool together with the counters recorded for it.
+type poolSample struct {
+	name    string
+	metrics *PoolMetrics
+}
+
+// Render returns the metrics of the pools in the Prometheus text exposition format. Servers are identified
+// by the pool, server_id and url labels, series of servers no longer in a pool are not rendered.
+func (r *Registry) Render(pools Pools) []byte {
+	var (
+		poolSamples   []poolSample
+		serverSamples []serverSample
+	)
+
+	for _, name := range pools.PoolNames() {
+		sp, exists := pools.Pool(name)
+		if !exists {
+			continue
+		}
+
+		pm := r.Pool(name)
+		poolSamples = append(poolSamples, poolSample{name: name, metrics: pm})
+
+		for _, srv := range sp.ListServers() {
+			serverSamples = append(serverSamples, serverSample{
+				labels: []label{{"pool", name}, {"server_id", srv.GetID()}, {"url", srv.GetURL().String()}},
+				srv:    srv,
+				stats:  pm.lookup(srv.GetID()),
+			})
+		}
+	}
+
+	var e encoder
+
+	e.family("golift_requests_total", "counter", "Requests proxied to a server, by status class.")
+	for _, s := range serverSamples {
+		if s.stats == nil {
+			continue
+		}
+
+		for i := range s.stats.requests {
+			if n := s.stats.requests[i].Load(); n > 0 {
+				e.sample("golift_requests_total", with(s.labels, "code", statusClasses[i]), float64(n))
+			}
+		}
+	}
+
+	e.family("golift_request_duration_seconds", "histogram", "Latency of requests proxied to a server.")
+	for _, s := range serverSamples {
+		if s.stats != nil {
+			e.histogram("golift_request_duration_seconds", s.labels, s.stats.latency)
+		}
+	}
+
+	e.family("golift_selections_total", "counter", "Times a server was selected, by load balancing strategy.")
+	for _, s := range serverSamples {
+		if s.stats == nil {
+			continue
+		}
+
+		strategies, counts := s.stats.selections.values()
+		for i, strategy := range strategies {
+			e.sample("golift_selections_total", with(s.labels, "strategy", strategy), float64(counts[i]))
+		}
+	}
+
+	e.family("golift_selection_failures_total", "counter", "Requests for which no server was available, by load balancing strategy.")
+	for _, p := range poolSamples {
+		strategies, counts := p.metrics.failures.values()
+		for i, strategy := range strategies {
+			e.sample("golift_selection_failures_total", []label{{"pool", p.name}, {"strategy", strategy}}, float64(counts[i]))
+		}
+	}
+
+	e.family("golift_health_checks_total", "counter", "Health check probes of a server, by result.")
+	for _, s := range serverSamples {
+		if s.stats == nil {
+			continue
+		}
+
+		results, counts := s.stats.healthChecks.values()
+		for i, result := range results {
+			e.sample("golift_health_checks_total", with(s.labels, "result", result), float64(counts[i]))
+		}
+	}
+
+	e.family("golift_server_active_connections", "gauge", "Requests currently proxied to a server.")
+	for _, s := range serverSamples {
+		e.sample("golift_server_active_connections", s.labels, float64(s.srv.GetActiveConnections()))
+	}
+
+	e.family("golift_server_alive", "gauge", "Whether a server is alive and not ejected (1) or not (0).")
+	for _, s := range serverSamples {
+		e.sample("golift_server_alive", s.labels, boolValue(s.srv.IsAlive()))
+	}
+
+	e.family("golift_server_ejected", "gauge", "Whether a server is ejected by outlier detection (1) or not (0).")
+	for _, s := range serverSamples {
+		e.sample("golift_server_ejected", s.labels, boolValue(s.srv.IsEjected()))
+	}
+
+	e.family("golift_server_draining", "gauge", "Whether a server is draining (1) or not (0).")
+	for _, s := range serverSamples {
+		e.sample("golift_server_draining", s.labels, boolValue(s.srv.IsDraining()))
+	}
+
+	return e.buf.Bytes()
+}
+
+// with returns labels extended by name="value", without modifying labels.
+func with(labels []label, name, value string) []label {
+	return append(labels[:len(labels):len(labels)], label{name, value})
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// encoder writes metric families in the Prometheus text exposition format.
+// Every sample of a family has to be written right after the family.
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) family(name, typ, help string) {
+	e.buf.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	e.buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func (e *encoder) sample(name string, labels []label, value float64) {
+	e.buf.WriteString(name)
+
+	if len(labels) > 0 {
+		e.buf.WriteByte('{')
+
+		for i, l := range labels {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+
+			e.buf.WriteString(l.name + `="` + labelEscaper.Replace(l.value) + `"`)
+		}
+
+		e.buf.WriteByte('}')
+	}
+
+	e.buf.WriteString(" " + formatValue(value) + "\n")
+}
+
+// histogram writes the cumulative buckets, sum and count of h.
+func (e *encoder) histogram(name string, labels []label, h *histogram) {
+	var cumulative uint64
+
+	for i := range h.counts {
+		cumulative += h.counts[i].Load()
+
+		le := math.Inf(1)
+		if i < len(h.bounds) {
+			le = h.bounds[i]
+		}
+
+		e.sample(name+"_bucket", with(labels, "le", formatValue(le)), float64(cumulative))
+	}
+
+	e.sample(name+"_sum", labels, time.Duration(h.sum.Load()).Seconds())
+	e.sample(name+"_count", labels, float64(cumulative))
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
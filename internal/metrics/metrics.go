@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ashtishad/golift/internal/domain"
+)
+
+// latencyBuckets are the upper bounds in seconds of the request latency histogram buckets.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// statusClasses are the label values of the status class counters, indexed by status/100 - 1.
+var statusClasses = [...]string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// Registry collects the metrics of every pool and renders them in the Prometheus text format.
+// Pool metrics are kept by name, so counters survive reloads that keep a pool.
+type Registry struct {
+	mux   sync.Mutex
+	pools map[string]*PoolMetrics
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{pools: make(map[string]*PoolMetrics)}
+}
+
+// Pool returns the metrics of the named pool, creating them on first use.
+func (r *Registry) Pool(name string) *PoolMetrics {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	pm, exists := r.pools[name]
+	if !exists {
+		pm = &PoolMetrics{servers: make(map[string]*serverStats)}
+		r.pools[name] = pm
+	}
+
+	return pm
+}
+
+// PoolMetrics records the traffic and health checks of a single pool. It implements domain.ResponseObserver
+// and domain.SelectionObserver for the proxy handler, domain.HealthCheckObserver for the health checker and
+// domain.PoolObserver to forget removed servers.
+type PoolMetrics struct {
+	mux      sync.RWMutex
+	servers  map[string]*serverStats // Keyed by server id.
+	failures counters                // Selections that found no server, keyed by strategy.
+}
+
+// serverStats are the counters of a single server, updated without locking.
+type serverStats struct {
+	requests     [len(statusClasses)]atomic.Uint64
+	latency      *histogram
+	selections   counters // Keyed by strategy.
+	healthChecks counters // Keyed by result, "success" or "failure".
+}
+
+// stats returns the counters of srv, creating them on first use.
+func (pm *PoolMetrics) stats(srv domain.Server) *serverStats {
+	pm.mux.RLock()
+	s, exists := pm.servers[srv.GetID()]
+	pm.mux.RUnlock()
+
+	if exists {
+		return s
+	}
+
+	pm.mux.Lock()
+	defer pm.mux.Unlock()
+
+	if s, exists = pm.servers[srv.GetID()]; !exists {
+		s = &serverStats{latency: newHistogram(latencyBuckets)}
+		pm.servers[srv.GetID()] = s
+	}
+
+	return s
+}
+
+// lookup returns the counters of the server with the given id, nil if nothing was recorded yet.
+func (pm *PoolMetrics) lookup(srvID string) *serverStats {
+	pm.mux.RLock()
+	defer pm.mux.RUnlock()
+
+	return pm.servers[srvID]
+}
+
+// ObserveResponse counts the response by status class and records its latency, implementing domain.ResponseObserver.
+func (pm *PoolMetrics) ObserveResponse(srv domain.Server, statusCode int, latency time.Duration) {
+	s := pm.stats(srv)
+
+	if class := statusCode/100 - 1; class >= 0 && class < len(s.requests) {
+		s.requests[class].Add(1)
+	}
+
+	s.latency.observe(latency.Seconds())
+}
+
+// ObserveSelection counts the selection of srv by the strategy, implementing domain.SelectionObserver.
+func (pm *PoolMetrics) ObserveSelection(strategy string, srv domain.Server) {
+	if srv == nil {
+		pm.failures.inc(strategy)
+		return
+	}
+
+	pm.stats(srv).selections.inc(strategy)
+}
+
+// ObserveHealthCheck counts the probe result of srv, implementing domain.HealthCheckObserver.
+func (pm *PoolMetrics) ObserveHealthCheck(srv domain.Server, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	pm.stats(srv).healthChecks.inc(result)
+}
+
+// ServerAdded implements domain.PoolObserver, counters are created lazily on the first observation.
+func (pm *PoolMetrics) ServerAdded(domain.Server) {}
+
+// ServerRemoved drops the counters of srv, implementing domain.PoolObserver.
+func (pm *PoolMetrics) ServerRemoved(srv domain.Server) {
+	pm.mux.Lock()
+	defer pm.mux.Unlock()
+
+	delete(pm.servers, srv.GetID())
+}
+
+// Handler serves the metrics of the pools in the Prometheus text exposition format.
+// Gauges such as active connections are read from the pools on every scrape.
+func (r *Registry) Handler(pools Pools) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write(r.Render(pools))
+	})
+}
+
+// counters is a set of counters keyed by a label value, created on first use.
+type counters struct {
+	mux sync.RWMutex
+	m   map[string]*atomic.Uint64
+}
+
+func (c *counters) inc(key string) {
+	c.mux.RLock()
+	n, exists := c.m[key]
+	c.mux.RUnlock()
+
+	if !exists {
+		c.mux.Lock()
+		if n, exists = c.m[key]; !exists {
+			if c.m == nil {
+				c.m = make(map[string]*atomic.Uint64)
+			}
+
+			n = new(atomic.Uint64)
+			c.m[key] = n
+		}
+		c.mux.Unlock()
+	}
+
+	n.Add(1)
+}
+
+// values returns the keys in sorted order together with their counts.
+func (c *counters) values() ([]string, []uint64) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	keys := make([]string, 0, len(c.m))
+	for key := range c.m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	counts := make([]uint64, len(keys))
+	for i, key := range keys {
+		counts[i] = c.m[key].Load()
+	}
+
+	return keys, counts
+}
+
+// histogram counts observations into buckets by upper bound, the last bucket is +Inf.
+type histogram struct {
+	bounds []float64
+	counts []atomic.Uint64
+	sum    atomic.Uint64 // Sum of all observations in nanoseconds.
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]atomic.Uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(seconds float64) {
+	// Buckets are inclusive, the first bound >= seconds.
+	h.counts[sort.SearchFloat64s(h.bounds, seconds)].Add(1)
+	h.sum.Add(uint64(seconds * float64(time.Second)))
+}
@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashtishad/golift/internal/domain"
+)
+
+// testPools is a Pools with a single pool named "web".
+type testPools struct {
+	pool domain.ServerPooler
+}
+
+func (tp testPools) PoolNames() []string { return []string{"web"} }
+
+func (tp testPools) Pool(name string) (domain.ServerPooler, bool) {
+	return tp.pool, name == "web"
+}
+
+func newTestPool(t *testing.T, pm *PoolMetrics, urls ...string) (domain.ServerPooler, []domain.Server) {
+	t.Helper()
+
+	strategy, err := domain.NewStrategy("round_robin", nil)
+	if err != nil {
+		t.Fatalf("failed to create strategy: %v", err)
+	}
+
+	pool := domain.NewServerPool(strategy, len(urls), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		domain.WithStrategyName("round_robin"))
+	pool.Subscribe(pm)
+
+	servers := make([]domain.Server, 0, len(urls))
+
+	for _, rawURL := range urls {
+		srv, err := domain.NewServer(rawURL)
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		if appErr := pool.AddServer(context.Background(), srv); appErr != nil {
+			t.Fatalf("failed to add server: %v", appErr)
+		}
+
+		servers = append(servers, srv)
+	}
+
+	return pool, servers
+}
+
+// TestRegistry_Render tests that observations are rendered as Prometheus samples labelled by pool,
+// server id and url, and that removed servers are no longer rendered.
+func TestRegistry_Render(t *testing.T) {
+	r := NewRegistry()
+	pm := r.Pool("web")
+	pool, servers := newTestPool(t, pm, "http://127.0.0.1:7001", "http://127.0.0.1:7002")
+	a, b := servers[0], servers[1]
+
+	pm.ObserveSelection("round_robin", a)
+	pm.ObserveSelection("round_robin", a)
+	pm.ObserveSelection("round_robin", nil)
+	pm.ObserveResponse(a, http.StatusOK, 3*time.Millisecond)
+	pm.ObserveResponse(a, http.StatusBadGateway, 200*time.Millisecond)
+	pm.ObserveResponse(a, domain.StatusClientClosedRequest, 20*time.Second)
+	pm.ObserveHealthCheck(a, nil)
+	pm.ObserveHealthCheck(a, errors.New("probe request failed"))
+	pm.ObserveHealthCheck(b, nil)
+	a.Drain()
+
+	labels := func(srv domain.Server) string {
+		return `pool="web",server_id="` + srv.GetID() + `",url="` + srv.GetURL().String() + `"`
+	}
+
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "requests 2xx", line: `golift_requests_total{` + labels(a) + `,code="2xx"} 1`},
+		{name: "requests 4xx", line: `golift_requests_total{` + labels(a) + `,code="4xx"} 1`},
+		{name: "requests 5xx", line: `golift_requests_total{` + labels(a) + `,code="5xx"} 1`},
+		{name: "first bucket", line: `golift_request_duration_seconds_bucket{` + labels(a) + `,le="0.005"} 1`},
+		{name: "middle bucket", line: `golift_request_duration_seconds_bucket{` + labels(a) + `,le="0.25"} 2`},
+		{name: "last bucket", line: `golift_request_duration_seconds_bucket{` + labels(a) + `,le="10"} 2`},
+		{name: "inf bucket", line: `golift_request_duration_seconds_bucket{` + labels(a) + `,le="+Inf"} 3`},
+		{name: "sum", line: `golift_request_duration_seconds_sum{` + labels(a) + `} 20.203`},
+		{name: "count", line: `golift_request_duration_seconds_count{` + labels(a) + `} 3`},
+		{name: "selections", line: `golift_selections_total{` + labels(a) + `,strategy="round_robin"} 2`},
+		{name: "selection failures", line: `golift_selection_failures_total{pool="web",strategy="round_robin"} 1`},
+		{name: "health check success", line: `golift_health_checks_total{` + labels(a) + `,result="success"} 1`},
+		{name: "health check failure", line: `golift_health_checks_total{` + labels(a) + `,result="failure"} 1`},
+		{name: "active connections", line: `golift_server_active_connections{` + labels(b) + `} 0`},
+		{name: "draining", line: `golift_server_draining{` + labels(a) + `} 1`},
+		{name: "not alive while draining", line: `golift_server_alive{` + labels(a) + `} 0`},
+		{name: "alive", line: `golift_server_alive{` + labels(b) + `} 1`},
+		{name: "type", line: `# TYPE golift_request_duration_seconds histogram`},
+	}
+
+	lines := strings.Split(string(r.Render(testPools{pool})), "\n")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !slices.Contains(lines, tt.line) {
+				t.Errorf("expected line %q in:\n%s", tt.line, strings.Join(lines, "\n"))
+			}
+		})
+	}
+
+	if appErr := pool.RemoveServer(context.Background(), a.GetID()); appErr != nil {
+		t.Fatalf("failed to remove server: %v", appErr)
+	}
+
+	if out := string(r.Render(testPools{pool})); strings.Contains(out, a.GetID()) {
+		t.Errorf("expected removed server not to be rendered:\n%s", out)
+	}
+}
+
+// TestRegistry_Handler tests that metrics are served with the exposition format content type.
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	pool, _ := newTestPool(t, r.Pool("web"), "http://127.0.0.1:7001")
+
+	rec := httptest.NewRecorder()
+	r.Handler(testPools{pool}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("expected content type %q, got %q", ContentType, got)
+	}
+
+	if !strings.Contains(rec.Body.String(), "golift_server_alive{") {
+		t.Errorf("expected server gauges, got:\n%s", rec.Body.String())
+	}
+}
+
+// TestEncoder_Escaping tests that label values and help texts are escaped.
+func TestEncoder_Escaping(t *testing.T) {
+	var e encoder
+
+	e.family("test_metric", "gauge", "Help with \\ and\nnewline.")
+	e.sample("test_metric", []label{{"value", "a\"b\\c\nd"}}, 1.5)
+
+	want := "# HELP test_metric Help with \\\\ and\\nnewline.\n" +
+		"# TYPE test_metric gauge\n" +
+		"test_metric{value=\"a\\\"b\\\\c\\nd\"} 1.5\n"
+
+	if got := e.buf.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
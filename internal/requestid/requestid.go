@@ -0,0 +1,139 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// DefaultHeader is the header carrying the request id unless configured otherwise.
+const DefaultHeader = "X-Request-ID"
+
+// maxLength bounds the length of a trusted incoming id, longer ones are replaced.
+const maxLength = 128
+
+// LogKey is the key of the attribute added to log records emitted while handling a request.
+const LogKey = "request_id"
+
+type idKey struct{}
+
+// New returns a random id of 32 hex digits.
+func New() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+
+	return hex.EncodeToString(b[:])
+}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// FromContext returns the id carried by ctx, empty if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// Handler assigns every request served by next an id, which is set on the header of the request,
+// so it is forwarded to the backend, and of the response, and carried by the request context.
+// If trust is set an id sent by the client in header is kept, unless it is empty, longer than
+// 128 characters or contains anything but printable ASCII.
+func Handler(next http.Handler, header string, trust bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header)
+		if !trust || !valid(id) {
+			id = New()
+		}
+
+		r.Header.Set(header, id)
+
+		iw := &idWriter{ResponseWriter: w, header: header, id: id}
+		next.ServeHTTP(iw, r.WithContext(NewContext(r.Context(), id)))
+
+		// The server writes the header of a handler that wrote nothing itself.
+		iw.setHeader()
+	})
+}
+
+// idWriter sets the id on the response header right before it is written, replacing any value copied
+// from the backend's response by a reverse proxy, so the header is sent exactly once.
+type idWriter struct {
+	http.ResponseWriter
+	header string
+	id     string
+	wrote  bool
+}
+
+func (w *idWriter) setHeader() {
+	if !w.wrote {
+		w.wrote = true
+		w.ResponseWriter.Header().Set(w.header, w.id)
+	}
+}
+
+func (w *idWriter) WriteHeader(code int) {
+	w.setHeader()
+
+	// Informational 1xx headers may precede the final one, which gets the id again.
+	if code < http.StatusOK {
+		w.wrote = false
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *idWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. for flushing.
+func (w *idWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// valid reports whether id is safe to log and forward.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// LogHandler adds the id carried by the context of a record, if any, as the request_id attribute.
+// Records only carry it when logged with a context, e.g. by Logger.ErrorContext.
+type LogHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler wraps h.
+func NewLogHandler(h slog.Handler) *LogHandler {
+	return &LogHandler{Handler: h}
+}
+
+func (h *LogHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := FromContext(ctx); id != "" {
+		rec.AddAttrs(slog.String(LogKey, id))
+	}
+
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return NewLogHandler(h.Handler.WithAttrs(attrs))
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return NewLogHandler(h.Handler.WithGroup(name))
+}
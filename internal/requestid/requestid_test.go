@@ -0,0 +1,103 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHandler tests that requests get a new id unless a valid incoming one is trusted, and that the id
+// reaches the request header, the response header and the request context.
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		trust    bool
+		wantKept bool
+	}{
+		{name: "Generated", trust: true},
+		{name: "Untrusted", incoming: "client-id", trust: false},
+		{name: "Trusted", incoming: "client-id", trust: true, wantKept: true},
+		{name: "Trusted Too Long", incoming: strings.Repeat("a", 129), trust: true},
+		{name: "Trusted With Space", incoming: "client id", trust: true},
+		{name: "Trusted Non ASCII", incoming: "clïent", trust: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forwarded, fromCtx string
+
+			handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded, fromCtx = r.Header.Get("X-Trace-Id"), FromContext(r.Context())
+			}), "X-Trace-Id", tt.trust)
+
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			if tt.incoming != "" {
+				req.Header.Set("X-Trace-Id", tt.incoming)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get("X-Trace-Id")
+			if forwarded != id || fromCtx != id {
+				t.Fatalf("expected the same id everywhere, got response %q, request %q, context %q", id, forwarded, fromCtx)
+			}
+
+			if kept := id == tt.incoming; kept != tt.wantKept {
+				t.Errorf("expected incoming id kept %v, got id %q", tt.wantKept, id)
+			}
+
+			if !tt.wantKept && len(id) != 32 {
+				t.Errorf("expected a generated id of 32 hex digits, got %q", id)
+			}
+		})
+	}
+
+	if New() == New() {
+		t.Errorf("expected generated ids to differ")
+	}
+}
+
+// TestHandler_UpstreamHeader tests that the response carries the id once, even if the handler copied
+// the header of a backend's response like a reverse proxy does.
+func TestHandler_UpstreamHeader(t *testing.T) {
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace-Id", r.Header.Get("X-Trace-Id"))
+		w.WriteHeader(http.StatusNoContent)
+	}), "X-Trace-Id", false)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	if got := rec.Header().Values("X-Trace-Id"); len(got) != 1 {
+		t.Errorf("expected a single id on the response, got %q", got)
+	}
+}
+
+// TestLogHandler tests that records logged with the context of a request carry its id.
+func TestLogHandler(t *testing.T) {
+	var out bytes.Buffer
+
+	l := slog.New(NewLogHandler(slog.NewTextHandler(&out, nil))).With("pool", "web")
+
+	l.InfoContext(NewContext(context.Background(), "req-1"), "proxied")
+	l.InfoContext(context.Background(), "idle")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two lines, got %q", out.String())
+	}
+
+	if !strings.Contains(lines[0], "pool=web request_id=req-1") {
+		t.Errorf("expected request id on the first line, got %q", lines[0])
+	}
+
+	if strings.Contains(lines[1], LogKey) {
+		t.Errorf("expected no request id without one in the context, got %q", lines[1])
+	}
+}
@@ -0,0 +1,279 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	exportQueueSize = 2048             // Ended spans waiting for export, further spans are dropped.
+	exportBatchSize = 512              // Upper bound of spans sent in one request.
+	exportInterval  = 5 * time.Second  // Time between two exports of a partial batch.
+	exportTimeout   = 10 * time.Second // Upper bound of a single export request.
+)
+
+// instrumentationScope names the code that created the spans in exported traces.
+const instrumentationScope = "github.com/ashtishad/golift"
+
+// Exporter sends ended spans in batches to an OTLP/HTTP traces endpoint, encoded as OTLP JSON.
+// Spans are queued without blocking the request that ended them and dropped if the queue is full.
+type Exporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+	l           *slog.Logger
+
+	queue   chan *Span
+	dropped atomic.Uint64
+
+	start    sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewExporter creates an exporter posting to endpoint, e.g. "http://127.0.0.1:4318/v1/traces", which reports
+// spans as created by serviceName. Nothing is sent before Start.
+func NewExporter(endpoint, serviceName string, l *slog.Logger) *Exporter {
+	return &Exporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		l:           l,
+		queue:       make(chan *Span, exportQueueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start begins exporting queued spans in the background until Shutdown.
+func (e *Exporter) Start() {
+	e.start.Do(func() { go e.run() })
+}
+
+// Shutdown exports the spans still queued and stops the exporter. It returns once the last export
+// completed or failed, which takes at most exportTimeout.
+func (e *Exporter) Shutdown() {
+	e.stopOnce.Do(func() { close(e.stop) })
+	e.Start() // Flushes spans ended before an exporter that was never started is shut down.
+	<-e.done
+}
+
+// export queues an ended span.
+func (e *Exporter) export(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, exportBatchSize)
+
+	flush := func() {
+		if len(batch) > 0 {
+			e.send(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			if batch = append(batch, s); len(batch) == exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case s := <-e.queue:
+					if batch = append(batch, s); len(batch) == exportBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send posts spans to the endpoint, failures are logged and the spans discarded.
+func (e *Exporter) send(spans []*Span) {
+	if n := e.dropped.Swap(0); n > 0 {
+		e.l.Warn("dropped spans, export queue is full", "count", n)
+	}
+
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		e.l.Error("failed to encode spans", "err", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	if err := e.post(ctx, body); err != nil {
+		e.l.Error("failed to export spans", "endpoint", e.endpoint, "count", len(spans), "err", err)
+	}
+}
+
+func (e *Exporter) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// OTLP JSON encoding of an export request, see opentelemetry-proto's trace_service.proto.
+// Ids are hex encoded and 64-bit integers are decimal strings, as the protobuf JSON mapping requires.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		TraceState        string          `json:"traceState,omitempty"`
+		Name              string          `json:"name"`
+		Kind              SpanKind        `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+
+	otlpStatus struct {
+		Code    StatusCode `json:"code,omitempty"`
+		Message string     `json:"message,omitempty"`
+	}
+)
+
+func (e *Exporter) request(spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, encodeSpan(s))
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttributes([]Attribute{String("service.name", e.serviceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: instrumentationScope}, Spans: encoded}},
+	}}}
+}
+
+func encodeSpan(s *Span) otlpSpan {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	encoded := otlpSpan{
+		TraceID:           hex.EncodeToString(s.ctx.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.ctx.SpanID[:]),
+		TraceState:        s.ctx.TraceState,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        encodeAttributes(s.attrs),
+		Status:            otlpStatus{Code: s.status, Message: s.statusMessage},
+	}
+
+	if s.parent != (SpanID{}) {
+		encoded.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+
+	return encoded
+}
+
+func encodeAttributes(attrs []Attribute) []otlpAttribute {
+	encoded := make([]otlpAttribute, 0, len(attrs))
+
+	for _, a := range attrs {
+		var v otlpValue
+
+		switch value := a.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case int64:
+			n := strconv.FormatInt(value, 10)
+			v.IntValue = &n
+		case float64:
+			v.DoubleValue = &value
+		case bool:
+			v.BoolValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+
+		encoded = append(encoded, otlpAttribute{Key: a.Key, Value: v})
+	}
+
+	return encoded
+}
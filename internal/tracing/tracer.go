@@ -0,0 +1,303 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C trace context headers, see https://www.w3.org/TR/trace-context/.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TraceID identifies a trace, SpanID a single span within it.
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+// SpanContext is the part of a span that is propagated to other services.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool   // Whether the trace is recorded.
+	TraceState string // Vendor specific tracestate header, passed on unchanged.
+}
+
+// IsValid reports whether neither id is all zeros.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// Extract returns the span context propagated by the traceparent and tracestate headers of h.
+// The second result is false if the traceparent header is missing or invalid.
+func Extract(h http.Header) (SpanContext, bool) {
+	sc, ok := ParseTraceparent(h.Get(TraceparentHeader))
+	if !ok {
+		return SpanContext{}, false
+	}
+
+	sc.TraceState = strings.Join(h.Values(TracestateHeader), ",")
+
+	return sc, true
+}
+
+// Inject sets the traceparent and tracestate headers of h to propagate sc.
+func Inject(h http.Header, sc SpanContext) {
+	h.Set(TraceparentHeader, sc.Traceparent())
+
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// ParseTraceparent parses a traceparent header value, e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+// Values of future versions are accepted as long as they start with the fields of version 00.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	const length = 55 // Length of a version 00 value.
+
+	if len(value) < length || (len(value) > length && value[length] != '-') {
+		return SpanContext{}, false
+	}
+
+	version, traceID, spanID, flags := value[0:2], value[3:35], value[36:52], value[53:55]
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return SpanContext{}, false
+	}
+
+	if version == "ff" || (version == "00" && len(value) != length) {
+		return SpanContext{}, false
+	}
+
+	var (
+		sc   SpanContext
+		v, f [1]byte
+	)
+
+	if !decodeHex(v[:], version) || !decodeHex(sc.TraceID[:], traceID) || !decodeHex(sc.SpanID[:], spanID) ||
+		!decodeHex(f[:], flags) || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+
+	sc.Sampled = f[0]&1 == 1
+
+	return sc, true
+}
+
+// decodeHex decodes the lowercase hex s into dst, which has to be exactly as long as the decoded s.
+func decodeHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return false
+	}
+
+	return copy(dst, b) == len(b)
+}
+
+// SpanKind is the role of a span in a request, numbered as in OTLP.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Attribute is a key value pair describing a span, Value is a string, int64, float64 or bool.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Tracer starts spans and hands them to its exporter once they end. A nil *Tracer disables tracing,
+// it starts nil spans whose methods do nothing.
+type Tracer struct {
+	exporter    *Exporter
+	sampleRatio float64
+}
+
+// NewTracer creates a tracer exporting spans through exporter. Traces started by the tracer are recorded
+// with probability sampleRatio, continued traces are recorded if the caller records them.
+func NewTracer(exporter *Exporter, sampleRatio float64) *Tracer {
+	return &Tracer{exporter: exporter, sampleRatio: sampleRatio}
+}
+
+// Start starts a span of the given kind as a child of parent, or as the root of a new trace if parent is invalid.
+func (t *Tracer) Start(name string, kind SpanKind, parent SpanContext) *Span {
+	if t == nil {
+		return nil
+	}
+
+	s := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+
+	if parent.IsValid() {
+		s.parent = parent.SpanID
+		s.ctx = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled, TraceState: parent.TraceState}
+	} else {
+		s.ctx.TraceID = TraceID(randomBytes(16))
+		s.ctx.Sampled = t.sample(s.ctx.TraceID)
+	}
+
+	s.ctx.SpanID = SpanID(randomBytes(8))
+
+	return s
+}
+
+// StartServer starts a server span for the incoming request r, continuing the trace propagated by its headers.
+func (t *Tracer) StartServer(r *http.Request) *Span {
+	if t == nil {
+		return nil
+	}
+
+	parent, _ := Extract(r.Header)
+	s := t.Start(r.Method, SpanKindServer, parent)
+
+	s.SetAttributes(
+		String("http.request.method", r.Method),
+		String("url.path", r.URL.Path),
+		String("server.address", r.Host),
+	)
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		s.SetAttributes(String("client.address", host))
+	}
+
+	return s
+}
+
+// sample decides on a new trace from its random trace id, so the decision is stable for the trace.
+func (t *Tracer) sample(traceID TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+
+	// The last 8 bytes of a random trace id are uniformly distributed.
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11)/(1<<53) < t.sampleRatio
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return b
+}
+
+// StatusCode is the outcome of a span, numbered as in OTLP.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusError StatusCode = 2
+)
+
+// Span is a single timed operation of a trace. All methods are safe on a nil *Span and do nothing.
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   SpanKind
+	ctx    SpanContext
+	parent SpanID // Zero for the root span of a trace.
+	start  time.Time
+
+	mux           sync.Mutex
+	end           time.Time
+	attrs         []Attribute
+	status        StatusCode
+	statusMessage string
+}
+
+// Context returns the span context to propagate to downstream services.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.ctx
+}
+
+// Inject propagates the span in the headers of an outgoing request, so the receiver continues the trace.
+func (s *Span) Inject(h http.Header) {
+	if s == nil {
+		return
+	}
+
+	Inject(h, s.ctx)
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.mux.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mux.Unlock()
+}
+
+// SetError marks the span as failed with the given description.
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+
+	s.mux.Lock()
+	s.status, s.statusMessage = StatusError, message
+	s.mux.Unlock()
+}
+
+// End records the end time of the span and exports it if its trace is sampled. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mux.Lock()
+	ended := !s.end.IsZero()
+	if !ended {
+		s.end = time.Now()
+	}
+	s.mux.Unlock()
+
+	if !ended && s.ctx.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.export(s)
+	}
+}
@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestParseTraceparent tests that valid traceparent values are parsed and invalid ones rejected.
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{name: "Sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ok: true, sampled: true},
+		{name: "Not Sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", ok: true},
+		{name: "Future Version", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", ok: true, sampled: true},
+		{name: "Empty", value: ""},
+		{name: "Uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"},
+		{name: "Zero Trace ID", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "Zero Span ID", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "Forbidden Version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "Trailing Data", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{name: "Bad Separator", value: "00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "Not Hex", value: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("expected ok %v, got %v", tt.ok, ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			if sc.Sampled != tt.sampled {
+				t.Errorf("expected sampled %v, got %v", tt.sampled, sc.Sampled)
+			}
+
+			if want := "00" + tt.value[2:55]; sc.Traceparent() != want {
+				t.Errorf("expected traceparent %q, got %q", want, sc.Traceparent())
+			}
+		})
+	}
+}
+
+// TestTracer_Start tests that spans continue the trace and sampling decision of their parent,
+// and that new traces are sampled by ratio.
+func TestTracer_Start(t *testing.T) {
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	parent.TraceState = "vendor=value"
+
+	unsampled := parent
+	unsampled.Sampled = false
+
+	tests := []struct {
+		name        string
+		sampleRatio float64
+		parent      SpanContext
+		sampled     bool
+	}{
+		{name: "Sampled Parent", sampleRatio: 0.0001, parent: parent, sampled: true},
+		{name: "Unsampled Parent", sampleRatio: 1, parent: unsampled, sampled: false},
+		{name: "Root Always", sampleRatio: 1, sampled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := NewTracer(nil, tt.sampleRatio).Start("GET", SpanKindServer, tt.parent).Context()
+
+			if !sc.IsValid() || sc.Sampled != tt.sampled {
+				t.Fatalf("expected valid span context with sampled %v, got %+v", tt.sampled, sc)
+			}
+
+			if tt.parent.IsValid() && (sc.TraceID != tt.parent.TraceID || sc.SpanID == tt.parent.SpanID ||
+				sc.TraceState != tt.parent.TraceState) {
+				t.Errorf("expected child of %+v, got %+v", tt.parent, sc)
+			}
+		})
+	}
+
+	tracer, sampled := NewTracer(nil, 0.25), 0
+	for i := 0; i < 10000; i++ {
+		if tracer.Start("GET", SpanKindServer, SpanContext{}).Context().Sampled {
+			sampled++
+		}
+	}
+
+	if sampled < 2000 || sampled > 3000 {
+		t.Errorf("expected about 2500 of 10000 traces sampled, got %d", sampled)
+	}
+}
+
+// TestExporter_Shutdown tests that ended spans are posted as OTLP JSON to a collector on shutdown.
+func TestExporter_Shutdown(t *testing.T) {
+	var (
+		mux      sync.Mutex
+		requests []otlpRequest
+	)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mux.Lock()
+		requests = append(requests, req)
+		mux.Unlock()
+	}))
+	t.Cleanup(collector.Close)
+
+	exporter := NewExporter(collector.URL+"/v1/traces", "golift-test", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	exporter.Start()
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := NewTracer(exporter, 1).Start("GET", SpanKindServer, parent)
+	span.SetAttributes(String("golift.server.id", "srv"), Int("http.response.status_code", 502))
+	span.SetError("Bad Gateway")
+	span.End()
+	span.End()
+
+	exporter.Shutdown()
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if len(requests) != 1 || len(requests[0].ResourceSpans) != 1 {
+		t.Fatalf("expected a single export request, got %+v", requests)
+	}
+
+	rs := requests[0].ResourceSpans[0]
+	if attrs := rs.Resource.Attributes; len(attrs) != 1 || *attrs[0].Value.StringValue != "golift-test" {
+		t.Errorf("expected service.name golift-test, got %+v", attrs)
+	}
+
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+
+	got := spans[0]
+	if got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.ParentSpanID != "00f067aa0ba902b7" || got.Kind != SpanKindServer {
+		t.Errorf("expected server span continuing the parent trace, got %+v", got)
+	}
+
+	if got.Status.Code != StatusError || len(got.Attributes) != 2 || *got.Attributes[1].Value.IntValue != "502" {
+		t.Errorf("expected error status and attributes, got %+v", got)
+	}
+}
@@ -0,0 +1,443 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ashtishad/golift/internal/common"
+	"github.com/ashtishad/golift/internal/domain"
+)
+
+// defaultDrainTimeout bounds how long DELETE /servers/{id} waits for requests in flight by default.
+const defaultDrainTimeout = 30 * time.Second
+
+// strategyRequest is the body of PUT /strategy.
+type strategyRequest struct {
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// strategyResponse is returned by GET and PUT /strategy.
+type strategyResponse struct {
+	Name      string   `json:"name"`
+	Available []string `json:"available"`
+}
+
+// serverRequest is the body of POST /servers.
+type serverRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// statusRequest is the body of PUT /servers/{id}/status.
+type statusRequest struct {
+	Alive *bool `json:"alive"`
+}
+
+// logLevelBody is the request and response body of the /log/level endpoints.
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+// statusResponse is returned by GET /healthz and /readyz.
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// serverResponse describes a server of a pool.
+type serverResponse struct {
+	ID                string `json:"id"`
+	URL               string `json:"url"`
+	Alive             bool   `json:"alive"`
+	StatusOverride    *bool  `json:"statusOverride,omitempty"`
+	Ejected           bool   `json:"ejected"`
+	Draining          bool   `json:"draining"`
+	Weight            int    `json:"weight"`
+	ActiveConnections int    `json:"activeConnections"`
+	Latency           string `json:"latency"`
+}
+
+func newServerResponse(srv domain.Server) serverResponse {
+	return serverResponse{
+		ID:                srv.GetID(),
+		URL:               srv.GetURL().String(),
+		Alive:             srv.IsAlive(),
+		StatusOverride:    srv.StatusOverride(),
+		Ejected:           srv.IsEjected(),
+		Draining:          srv.IsDraining(),
+		Weight:            srv.GetWeight(),
+		ActiveConnections: srv.GetActiveConnections(),
+		Latency:           srv.GetLatency().Round(time.Microsecond).String(),
+	}
+}
+
+// PoolRegistry resolves the server pools managed by the admin API.
+type PoolRegistry interface {
+	// Pool returns the pool with the given name.
+	Pool(name string) (domain.ServerPooler, bool)
+
+	// PoolNames returns the names of all pools, the first one is used if a request names none.
+	PoolNames() []string
+
+	// Ready reports whether the load balancer accepts traffic, it turns false once shutting down.
+	Ready() bool
+
+	// NewServer creates a server for the named pool, configured like the pool's other backends,
+	// e.g. with its health thresholds. The server is not added to the pool yet.
+	NewServer(pool, rawURL string, weight int) (domain.Server, error)
+}
+
+// AdminHandler returns the handler of the admin listener, which manages the pools at runtime.
+// Every endpoint acts on the pool named by the "pool" query parameter, or the first pool if omitted:
+//
+//	GET    /strategy             returns the current strategy and all registered ones.
+//	PUT    /strategy             replaces the strategy while traffic is flowing, e.g. {"name": "p2c"}.
+//	GET    /servers              lists the servers of the pool.
+//	POST   /servers              registers a server, e.g. {"url": "http://10.0.0.7:8000", "weight": 2}.
+//	GET    /servers/{id}         returns a single server.
+//	DELETE /servers/{id}         drains a server and deregisters it once its requests in flight completed,
+//	                             or after ?timeout= (default 30s, 0 waits forever). ?drain=false removes it at once.
+//	PUT    /servers/{id}/status  pins a server alive or dead, e.g. {"alive": false}, health checks no longer change it.
+//	DELETE /servers/{id}/status  unpins the status of a server, handing it back to health checks.
+//	GET    /log/level            returns the level of the process logger.
+//	PUT    /log/level            changes the level at runtime, e.g. {"level": "debug"}, until log.level is reloaded.
+//	GET    /healthz              answers 200 while the process is running.
+//	GET    /readyz               answers 200 while accepting traffic, 503 once shutting down.
+//
+// Errors are rendered from common.AppError as problem details (RFC 9457) with a machine-readable code.
+func AdminHandler(pools PoolRegistry, level *slog.LevelVar, l *slog.Logger) http.Handler {
+	mux := http.NewServeMux()
+
+	handleStrategy(mux, pools, l)
+	handleServers(mux, pools, l)
+	handleLogLevel(mux, level, l)
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, statusResponse{Status: "ok"})
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !pools.Ready() {
+			writeError(w, r, common.NewServiceUnavailableError("load balancer is not ready").
+				WithErrorCode(common.ErrCodeShuttingDown))
+			return
+		}
+
+		writeJSON(w, http.StatusOK, statusResponse{Status: "ready"})
+	})
+
+	return mux
+}
+
+// handleStrategy registers the endpoints reading and replacing the strategy of a pool.
+func handleStrategy(mux *http.ServeMux, pools PoolRegistry, l *slog.Logger) {
+	mux.HandleFunc("GET /strategy", func(w http.ResponseWriter, r *http.Request) {
+		serverPool, appErr := lookupPool(pools, r)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, strategyResponse{Name: serverPool.StrategyName(), Available: domain.StrategyNames()})
+	})
+
+	mux.HandleFunc("PUT /strategy", func(w http.ResponseWriter, r *http.Request) {
+		name, serverPool, appErr := lookupNamedPool(pools, r)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		var req strategyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, common.NewBadRequestError("invalid request body: "+err.Error()).
+				WithErrorCode(common.ErrCodeInvalidRequestBody))
+			return
+		}
+
+		if req.Name == "" {
+			writeError(w, r, common.NewBadRequestError("strategy name is required").WithErrorCode(common.ErrCodeInvalidStrategy))
+			return
+		}
+
+		strategy, err := domain.NewStrategy(req.Name, req.Options)
+		if err != nil {
+			writeError(w, r, common.NewBadRequestError(err.Error()).WithErrorCode(common.ErrCodeInvalidStrategy))
+			return
+		}
+
+		serverPool.SetStrategy(r.Context(), req.Name, strategy)
+		l.InfoContext(r.Context(), "strategy changed via admin API", "pool", name, "strategy", req.Name,
+			"remote_addr", r.RemoteAddr)
+
+		writeJSON(w, http.StatusOK, strategyResponse{Name: req.Name, Available: domain.StrategyNames()})
+	})
+}
+
+// handleServers registers the endpoints managing the servers of a pool.
+func handleServers(mux *http.ServeMux, pools PoolRegistry, l *slog.Logger) {
+	mux.HandleFunc("GET /servers", func(w http.ResponseWriter, r *http.Request) {
+		serverPool, appErr := lookupPool(pools, r)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		servers := serverPool.ListServers()
+
+		resp := make([]serverResponse, 0, len(servers))
+		for _, srv := range servers {
+			resp = append(resp, newServerResponse(srv))
+		}
+
+		writeJSON(w, http.StatusOK, resp)
+	})
+
+	mux.HandleFunc("POST /servers", func(w http.ResponseWriter, r *http.Request) {
+		name, serverPool, appErr := lookupNamedPool(pools, r)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		var req serverRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, common.NewBadRequestError("invalid request body: "+err.Error()).
+				WithErrorCode(common.ErrCodeInvalidRequestBody))
+			return
+		}
+
+		if err := common.ValidateBackendURL(req.URL); err != nil {
+			writeError(w, r, common.NewBadRequestError(err.Error()).WithErrorCode(common.ErrCodeInvalidServer))
+			return
+		}
+
+		if req.Weight < 0 || req.Weight > common.MaxWeight {
+			appErr := common.NewBadRequestError(fmt.Sprintf("weight must be between 0 and %d", common.MaxWeight))
+			writeError(w, r, appErr.WithErrorCode(common.ErrCodeInvalidServer))
+			return
+		}
+
+		srv, err := pools.NewServer(name, req.URL, req.Weight)
+		if err != nil {
+			writeError(w, r, common.NewBadRequestError(err.Error()).WithErrorCode(common.ErrCodeInvalidServer))
+			return
+		}
+
+		if appErr := serverPool.AddServer(r.Context(), srv); appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		l.InfoContext(r.Context(), "server added via admin API", "pool", name, "srv_id", srv.GetID(), "url", req.URL,
+			"remote_addr", r.RemoteAddr)
+
+		w.Header().Set("Location", "/servers/"+srv.GetID()+"?pool="+url.QueryEscape(name))
+		writeJSON(w, http.StatusCreated, newServerResponse(srv))
+	})
+
+	mux.HandleFunc("GET /servers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		serverPool, appErr := lookupPool(pools, r)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		srv, appErr := serverPool.GetServer(r.Context(), r.PathValue("id"))
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, newServerResponse(srv))
+	})
+
+	mux.HandleFunc("DELETE /servers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		name, serverPool, appErr := lookupNamedPool(pools, r)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		srvID := r.PathValue("id")
+
+		if r.URL.Query().Get("drain") == "false" {
+			if appErr := serverPool.RemoveServer(r.Context(), srvID); appErr != nil {
+				writeError(w, r, appErr)
+				return
+			}
+
+			l.InfoContext(r.Context(), "server removed via admin API", "pool", name, "srv_id", srvID,
+				"remote_addr", r.RemoteAddr)
+
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		timeout := defaultDrainTimeout
+		if raw := r.URL.Query().Get("timeout"); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err == nil && parsed < 0 {
+				err = errors.New("must not be negative")
+			}
+
+			if err != nil {
+				writeError(w, r, common.NewBadRequestError("invalid timeout: "+err.Error()).
+					WithErrorCode(common.ErrCodeInvalidTimeout))
+				return
+			}
+
+			timeout = parsed
+		}
+
+		if _, appErr := serverPool.DrainServer(r.Context(), srvID, timeout); appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		l.InfoContext(r.Context(), "server draining via admin API", "pool", name, "srv_id", srvID, "timeout", timeout,
+			"remote_addr", r.RemoteAddr)
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	mux.HandleFunc("PUT /servers/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+		name, serverPool, appErr := lookupNamedPool(pools, r)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		var req statusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, common.NewBadRequestError("invalid request body: "+err.Error()).
+				WithErrorCode(common.ErrCodeInvalidRequestBody))
+			return
+		}
+
+		if req.Alive == nil {
+			writeError(w, r, common.NewBadRequestError("alive is required").WithErrorCode(common.ErrCodeInvalidRequestBody))
+			return
+		}
+
+		srvID := r.PathValue("id")
+		if appErr := serverPool.OverrideServerStatus(r.Context(), srvID, req.Alive); appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		srv, appErr := serverPool.GetServer(r.Context(), srvID)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		l.InfoContext(r.Context(), "server status pinned via admin API", "pool", name, "srv_id", srvID, "alive", *req.Alive,
+			"remote_addr", r.RemoteAddr)
+
+		writeJSON(w, http.StatusOK, newServerResponse(srv))
+	})
+
+	mux.HandleFunc("DELETE /servers/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+		name, serverPool, appErr := lookupNamedPool(pools, r)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		srvID := r.PathValue("id")
+		if appErr := serverPool.OverrideServerStatus(r.Context(), srvID, nil); appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		srv, appErr := serverPool.GetServer(r.Context(), srvID)
+		if appErr != nil {
+			writeError(w, r, appErr)
+			return
+		}
+
+		l.InfoContext(r.Context(), "server status unpinned via admin API", "pool", name, "srv_id", srvID,
+			"remote_addr", r.RemoteAddr)
+
+		writeJSON(w, http.StatusOK, newServerResponse(srv))
+	})
+}
+
+// handleLogLevel registers the endpoints reading and changing the level of the process logger.
+func handleLogLevel(mux *http.ServeMux, level *slog.LevelVar, l *slog.Logger) {
+	mux.HandleFunc("GET /log/level", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, logLevelBody{Level: level.Level().String()})
+	})
+
+	mux.HandleFunc("PUT /log/level", func(w http.ResponseWriter, r *http.Request) {
+		var req logLevelBody
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, common.NewBadRequestError("invalid request body: "+err.Error()).
+				WithErrorCode(common.ErrCodeInvalidRequestBody))
+			return
+		}
+
+		var newLevel slog.Level
+		if err := newLevel.UnmarshalText([]byte(req.Level)); err != nil {
+			writeError(w, r, common.NewBadRequestError("level must be debug, info, warn or error, got "+strconv.Quote(req.Level)).
+				WithErrorCode(common.ErrCodeInvalidLogLevel))
+			return
+		}
+
+		previous := level.Level()
+		level.Set(newLevel)
+
+		// Logged at warn, so the change shows up whatever the new level.
+		l.WarnContext(r.Context(), "log level changed via admin API", "from", previous, "to", newLevel,
+			"remote_addr", r.RemoteAddr)
+
+		writeJSON(w, http.StatusOK, logLevelBody{Level: newLevel.String()})
+	})
+}
+
+// lookupPool resolves the pool named by the "pool" query parameter of r.
+func lookupPool(pools PoolRegistry, r *http.Request) (domain.ServerPooler, common.AppError) {
+	_, serverPool, appErr := lookupNamedPool(pools, r)
+	return serverPool, appErr
+}
+
+// lookupNamedPool resolves the pool named by the "pool" query parameter of r, together with its name.
+func lookupNamedPool(pools PoolRegistry, r *http.Request) (string, domain.ServerPooler, common.AppError) {
+	name := r.URL.Query().Get("pool")
+	if name == "" {
+		names := pools.PoolNames()
+		if len(names) == 0 {
+			return "", nil, common.NewNotFoundError("no pool configured").WithErrorCode(common.ErrCodePoolNotFound)
+		}
+
+		name = names[0]
+	}
+
+	serverPool, exists := pools.Pool(name)
+	if !exists {
+		return "", nil, common.NewNotFoundError("pool " + strconv.Quote(name) + " not found").
+			WithErrorCode(common.ErrCodePoolNotFound)
+	}
+
+	return name, serverPool, nil
+}
+
+// writeJSON renders v as the JSON response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError renders appErr as problem details using its status code and error code.
+func writeError(w http.ResponseWriter, r *http.Request, appErr common.AppError) {
+	common.WriteError(w, r, appErr)
+}
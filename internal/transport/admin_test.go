@@ -0,0 +1,288 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashtishad/golift/internal/common"
+	"github.com/ashtishad/golift/internal/domain"
+	"github.com/ashtishad/golift/internal/requestid"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// singlePool is a PoolRegistry holding one pool named "default".
+type singlePool struct {
+	pool domain.ServerPooler
+}
+
+func (sp singlePool) Pool(name string) (domain.ServerPooler, bool) {
+	return sp.pool, name == "default"
+}
+
+func (sp singlePool) PoolNames() []string {
+	return []string{"default"}
+}
+
+func (sp singlePool) Ready() bool {
+	return sp.pool != nil
+}
+
+func (sp singlePool) NewServer(_, rawURL string, weight int) (domain.Server, error) {
+	return domain.NewServer(rawURL, domain.WithWeight(weight))
+}
+
+// TestAdminHandler_Strategy tests reading and replacing the strategy via the admin API.
+func TestAdminHandler_Strategy(t *testing.T) {
+	pool := domain.NewServerPool(&domain.LeastConnection{}, 0, discardLogger(), domain.WithStrategyName("least_connection"))
+	handler := AdminHandler(singlePool{pool: pool}, new(slog.LevelVar), discardLogger())
+
+	tests := []struct {
+		name         string
+		method       string
+		body         string
+		query        string
+		wantStatus   int
+		wantStrategy string
+	}{
+		{name: "Get Current", method: http.MethodGet, wantStatus: http.StatusOK, wantStrategy: "least_connection"},
+		{name: "Replace", method: http.MethodPut, body: `{"name": "ring_hash", "options": {"key": "header:X-User"}}`,
+			wantStatus: http.StatusOK, wantStrategy: "ring_hash"},
+		{name: "Unknown Strategy", method: http.MethodPut, body: `{"name": "fastest"}`,
+			wantStatus: http.StatusBadRequest, wantStrategy: "ring_hash"},
+		{name: "Invalid Options", method: http.MethodPut, body: `{"name": "maglev", "options": {"key": "query:id"}}`,
+			wantStatus: http.StatusBadRequest, wantStrategy: "ring_hash"},
+		{name: "Missing Name", method: http.MethodPut, body: `{}`,
+			wantStatus: http.StatusBadRequest, wantStrategy: "ring_hash"},
+		{name: "Malformed Body", method: http.MethodPut, body: `{`,
+			wantStatus: http.StatusBadRequest, wantStrategy: "ring_hash"},
+		{name: "Unknown Pool", method: http.MethodGet, query: "?pool=api",
+			wantStatus: http.StatusNotFound, wantStrategy: "ring_hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/strategy"+tt.query, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+
+			if rec.Code == http.StatusOK {
+				var resp strategyResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+
+				if resp.Name != tt.wantStrategy {
+					t.Errorf("expected response strategy %q, got %q", tt.wantStrategy, resp.Name)
+				}
+			}
+
+			if got := pool.StrategyName(); got != tt.wantStrategy {
+				t.Errorf("expected pool strategy %q, got %q", tt.wantStrategy, got)
+			}
+		})
+	}
+}
+
+// TestAdminHandler_Servers tests registering, inspecting, marking and deregistering servers via the admin API.
+func TestAdminHandler_Servers(t *testing.T) {
+	pool := domain.NewServerPool(&domain.LeastConnection{}, 0, discardLogger())
+	handler := AdminHandler(singlePool{pool: pool}, new(slog.LevelVar), discardLogger())
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/servers", `{"url": "http://10.0.0.7:8000", "weight": 2}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	var created serverResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if created.ID == "" || created.Weight != 2 || !created.Alive {
+		t.Errorf("unexpected created server %+v", created)
+	}
+
+	drainedID, err := common.GenerateServerID("http://10.0.0.9:8000")
+	if err != nil {
+		t.Fatalf("failed to generate server id: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{name: "Duplicate", method: http.MethodPost, target: "/servers", body: `{"url": "http://10.0.0.7:8000"}`,
+			wantStatus: http.StatusConflict},
+		{name: "Missing Port", method: http.MethodPost, target: "/servers", body: `{"url": "http://10.0.0.8"}`,
+			wantStatus: http.StatusBadRequest},
+		{name: "Malformed Body", method: http.MethodPost, target: "/servers", body: `{`,
+			wantStatus: http.StatusBadRequest},
+		{name: "Weight Too Large", method: http.MethodPost, target: "/servers",
+			body: `{"url": "http://10.0.0.8:8000", "weight": 100000000}`, wantStatus: http.StatusBadRequest},
+		{name: "List", method: http.MethodGet, target: "/servers", wantStatus: http.StatusOK},
+		{name: "Get", method: http.MethodGet, target: "/servers/" + created.ID, wantStatus: http.StatusOK},
+		{name: "Get Unknown", method: http.MethodGet, target: "/servers/nope", wantStatus: http.StatusNotFound},
+		{name: "Mark Dead", method: http.MethodPut, target: "/servers/" + created.ID + "/status",
+			body: `{"alive": false}`, wantStatus: http.StatusOK},
+		{name: "Unpin Status", method: http.MethodDelete, target: "/servers/" + created.ID + "/status",
+			wantStatus: http.StatusOK},
+		{name: "Unpin Unknown", method: http.MethodDelete, target: "/servers/nope/status",
+			wantStatus: http.StatusNotFound},
+		{name: "Status Missing", method: http.MethodPut, target: "/servers/" + created.ID + "/status",
+			body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "Unknown Pool", method: http.MethodGet, target: "/servers?pool=api", wantStatus: http.StatusNotFound},
+		{name: "Invalid Timeout", method: http.MethodDelete, target: "/servers/" + created.ID + "?timeout=soon",
+			wantStatus: http.StatusBadRequest},
+		{name: "Negative Timeout", method: http.MethodDelete, target: "/servers/" + created.ID + "?timeout=-1s",
+			wantStatus: http.StatusBadRequest},
+		{name: "Delete", method: http.MethodDelete, target: "/servers/" + created.ID + "?drain=false",
+			wantStatus: http.StatusNoContent},
+		{name: "Delete Again", method: http.MethodDelete, target: "/servers/" + created.ID,
+			wantStatus: http.StatusNotFound},
+		{name: "Add Another", method: http.MethodPost, target: "/servers", body: `{"url": "http://10.0.0.9:8000"}`,
+			wantStatus: http.StatusCreated},
+		{name: "Drain", method: http.MethodDelete, target: "/servers/" + drainedID + "?timeout=1m",
+			wantStatus: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// Without requests in flight the drained server is removed right away.
+	for i := 0; i < 50 && len(pool.ListServers()) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(pool.ListServers()) != 0 {
+		t.Errorf("expected pool to be empty, got %d servers", len(pool.ListServers()))
+	}
+}
+
+// TestAdminHandler_LogLevel tests reading and changing the log level via the admin API.
+func TestAdminHandler_LogLevel(t *testing.T) {
+	level := new(slog.LevelVar)
+	handler := AdminHandler(singlePool{}, level, discardLogger())
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantLevel  slog.Level
+	}{
+		{name: "Get Current", method: http.MethodGet, wantStatus: http.StatusOK, wantLevel: slog.LevelInfo},
+		{name: "Debug", method: http.MethodPut, body: `{"level": "debug"}`, wantStatus: http.StatusOK, wantLevel: slog.LevelDebug},
+		{name: "Case Insensitive", method: http.MethodPut, body: `{"level": "WARN"}`, wantStatus: http.StatusOK,
+			wantLevel: slog.LevelWarn},
+		{name: "Unknown Level", method: http.MethodPut, body: `{"level": "verbose"}`, wantStatus: http.StatusBadRequest,
+			wantLevel: slog.LevelWarn},
+		{name: "Malformed Body", method: http.MethodPut, body: `{`, wantStatus: http.StatusBadRequest,
+			wantLevel: slog.LevelWarn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/log/level", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+
+			if rec.Code == http.StatusOK {
+				var resp logLevelBody
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+
+				if resp.Level != tt.wantLevel.String() {
+					t.Errorf("expected response level %q, got %q", tt.wantLevel, resp.Level)
+				}
+			}
+
+			if got := level.Level(); got != tt.wantLevel {
+				t.Errorf("expected level %v, got %v", tt.wantLevel, got)
+			}
+		})
+	}
+}
+
+// TestAdminHandler_RequestIDLogged tests that records logged by the admin API and the pool while
+// handling a request carry its id.
+func TestAdminHandler_RequestIDLogged(t *testing.T) {
+	var out bytes.Buffer
+
+	l := slog.New(requestid.NewLogHandler(slog.NewTextHandler(&out, nil)))
+	pool := domain.NewServerPool(&domain.LeastConnection{}, 0, l)
+	handler := requestid.Handler(AdminHandler(singlePool{pool: pool}, new(slog.LevelVar), l), requestid.DefaultHeader, true)
+
+	for _, body := range []string{`{"url": "http://10.0.0.7:8000"}`, `{"url": "http://10.0.0.7:8000"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/servers", strings.NewReader(body))
+		req.Header.Set(requestid.DefaultHeader, "req-1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected the added server and the duplicate to be logged, got %q", out.String())
+	}
+
+	for _, line := range lines {
+		if !strings.Contains(line, "request_id=req-1") {
+			t.Errorf("expected request id on %q", line)
+		}
+	}
+}
+
+// TestAdminHandler_StrategyLogsPool tests that a strategy change logs the pool it was applied to,
+// also when the request relies on the default pool.
+func TestAdminHandler_StrategyLogsPool(t *testing.T) {
+	var out bytes.Buffer
+
+	pool := domain.NewServerPool(&domain.LeastConnection{}, 0, discardLogger())
+	handler := AdminHandler(singlePool{pool: pool}, new(slog.LevelVar), slog.New(slog.NewTextHandler(&out, nil)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/strategy", strings.NewReader(`{"name": "p2c"}`)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	if !strings.Contains(out.String(), "pool=default") {
+		t.Errorf("expected the resolved pool to be logged, got %q", out.String())
+	}
+}
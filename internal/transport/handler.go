@@ -3,16 +3,47 @@ package transport
 import (
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/ashtishad/golift/internal/accesslog"
+	"github.com/ashtishad/golift/internal/common"
 	"github.com/ashtishad/golift/internal/domain"
+	"github.com/ashtishad/golift/internal/tracing"
 )
 
-func ProxyRequestHandler(serverPool domain.ServerPooler, l *slog.Logger) http.HandlerFunc {
+// ProxyRequestHandler forwards every request to the server selected by serverPool and reports
+// the outcome of each proxied request to the given observers, e.g. an OutlierDetector.
+// Observers that also implement domain.SelectionObserver are notified about every selection.
+// Unless tracer is nil, every request gets a span covering selection and the upstream round trip,
+// which the server continues through the traceparent header.
+func ProxyRequestHandler(serverPool domain.ServerPooler, tracer *tracing.Tracer, l *slog.Logger, observers ...domain.ResponseObserver) http.HandlerFunc {
+	var selectionObservers []domain.SelectionObserver
+
+	for _, o := range observers {
+		if so, ok := o.(domain.SelectionObserver); ok {
+			selectionObservers = append(selectionObservers, so)
+		}
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		targetServer := serverPool.SelectServer()
+		span := tracer.StartServer(r)
+		defer span.End()
+
+		targetServer := serverPool.SelectServer(r)
+		strategy := serverPool.StrategyName()
+
+		for _, o := range selectionObservers {
+			o.ObserveSelection(strategy, targetServer)
+		}
+
+		span.SetAttributes(tracing.String("golift.strategy", strategy))
+
 		if targetServer == nil {
-			l.Error("target server unavailable", "srv", targetServer.GetURL())
-			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+			l.ErrorContext(r.Context(), "target server unavailable", "path", r.URL.Path)
+			span.SetAttributes(tracing.Int("http.response.status_code", http.StatusServiceUnavailable))
+			span.SetError("no server available")
+			common.WriteError(w, r, common.NewServiceUnavailableError("no server available").
+				WithErrorCode(common.ErrCodeNoServerAvailable))
 			return
 		}
 
@@ -23,7 +54,68 @@ func ProxyRequestHandler(serverPool domain.ServerPooler, l *slog.Logger) http.Ha
 		r.Header.Set("X-Forwarded-Host", r.Header.Get("Host"))
 		r.Host = targetURL.Host
 
+		span.SetAttributes(
+			tracing.String("golift.server.id", targetServer.GetID()),
+			tracing.String("golift.server.url", targetURL.String()),
+		)
+		span.Inject(r.Header)
+
 		// Serve the request using reverseProxy of server instance.
-		targetServer.Serve(w, r)
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		attempts := 1 // Requests are not retried, every request is a single upstream attempt.
+		targetServer.Serve(rec, r)
+		latency := time.Since(start)
+
+		accesslog.RecordUpstream(r.Context(), targetServer.GetID(), latency, attempts-1)
+
+		span.SetAttributes(
+			tracing.Int("http.response.status_code", rec.Status()),
+			tracing.Int("golift.retry.attempts", attempts-1),
+		)
+		if rec.Status() >= http.StatusInternalServerError {
+			span.SetError(http.StatusText(rec.Status()))
+		}
+
+		for _, o := range observers {
+			o.ObserveResponse(targetServer, rec.Status(), latency)
+		}
 	}
 }
+
+// statusRecorder captures the status code written by the reverse proxy.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	// Informational 1xx headers may precede the final status.
+	if rec.status == 0 && code >= http.StatusOK {
+		rec.status = code
+	}
+
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	return rec.ResponseWriter.Write(b)
+}
+
+// Status returns the recorded status code, 200 if the handler never wrote a header.
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+
+	return rec.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. for flushing.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
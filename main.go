@@ -3,10 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"log/slog"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,32 +14,116 @@ import (
 	"time"
 
 	"github.com/ashtishad/golift/internal/common"
-	"github.com/ashtishad/golift/internal/domain"
-	"github.com/ashtishad/golift/internal/transport"
 )
 
 func main() {
-	// init slogger
-	handlerOpts := common.GetSlogConf()
-	logger := slog.New(slog.NewTextHandler(os.Stdout, handlerOpts))
+	// "golift validate" checks a config file and exits without starting anything.
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	configPath := flag.String("config", "", "path to a YAML or JSON config file, built-in defaults if empty")
+	watchInterval := flag.Duration("watch-interval", 5*time.Second, "how often the config file is checked for changes, 0 disables")
+	flag.Parse()
+
+	// init slogger, its level is shared with the admin API to change it at runtime.
+	// Until the config is loaded, info and above is logged as text.
+	logLevel := new(slog.LevelVar)
+	logger := slog.New(slog.NewTextHandler(os.Stdout, common.GetSlogConf(logLevel, false)))
 	slog.SetDefault(logger)
 
-	// load config
-	conf := common.LoadConfig(logger)
+	// load config, environment variables override the config file.
+	conf, err := common.LoadConfig(*configPath, logger)
+	if err != nil {
+		logger.Error("failed to load config", "err", err)
+		os.Exit(1)
+	}
+
+	logger, err = common.NewLogger(os.Stdout, conf.Log, logLevel)
+	if err != nil {
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logger)
+
+	lb, err := newBalancer(conf, logLevel, logger)
+	if err != nil {
+		logger.Error("invalid configuration", "err", err)
+		os.Exit(1)
+	}
+
+	// Sockets passed by the process this one upgrades keep accepting connections throughout.
+	sockets, parentPID, err := inheritListeners()
+	if err != nil {
+		logger.Error("failed to inherit listeners", "err", err)
+		os.Exit(1)
+	}
+
+	lb.listen = sockets.Listen
+
+	// Background workers such as health checks run until lbCtx is canceled on shutdown.
+	lbCtx, lbCancel := context.WithCancel(context.Background())
+	defer lbCancel()
 
 	// Start servers and load balancer.
-	servers := startServers(conf, logger)
-	go startLoadBalancer(conf, logger)
+	servers := startServers(conf, sockets, logger)
+	if err := lb.start(lbCtx); err != nil {
+		logger.Error("failed to start load balancer", "err", err)
+		os.Exit(1)
+	}
+
+	sockets.closeUnused(logger)
+
+	if parentPID != 0 {
+		notifyParent(parentPID, logger)
+	}
+
+	// Reload the config file whenever it changes.
+	if *configPath != "" && *watchInterval > 0 {
+		go watchConfig(lbCtx, *configPath, *watchInterval, func() { lb.reloadConfig(*configPath) })
+	}
 
-	// Setup channel to listen for OS interrupt signals for graceful shutdown.
+	// Setup channel to listen for OS interrupt signals for graceful shutdown, SIGHUP reloads the config file
+	// and the upgradeSignals (SIGUSR2 on unix) upgrade to the executable currently on disk.
 	quitChan := make(chan os.Signal, 1)
-	signal.Notify(quitChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(quitChan, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, upgradeSignals...)...)
 
-	<-quitChan // Block until a signal is received.
+	sig := <-quitChan
+	for ; sig != syscall.SIGINT && sig != syscall.SIGTERM; sig = <-quitChan {
+		if sig == syscall.SIGHUP {
+			lb.reloadConfig(*configPath)
+			continue
+		}
+
+		if err := upgrade(sockets, logger); err != nil {
+			logger.Error("upgrade failed, keeping this process serving", "err", err)
+		}
+	}
+
+	logger.Info("received signal, shutting down gracefully", "signal", sig.String())
+
+	// A second signal aborts waiting for requests in flight.
+	go func() {
+		for sig := range quitChan {
+			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+				logger.Error("received second signal, exiting immediately", "signal", sig.String())
+				os.Exit(1)
+			}
+		}
+	}()
+
+	// Stop accepting connections and let proxied requests complete, health checks stop afterwards.
+	exitCode := 0
+	if err := lb.stop(); err != nil {
+		logger.Error("graceful shutdown incomplete", "err", err)
+		exitCode = 1
+	}
+
+	lbCancel()
 
 	// Shutdown logic for servers.
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
 
 	for _, server := range servers {
 		if err := server.Shutdown(ctx); err != nil {
@@ -47,13 +131,16 @@ func main() {
 		}
 	}
 
+	cancel()
+
 	log.Println("Servers shut down gracefully.")
+	os.Exit(exitCode)
 }
 
 // startServers launches n number of HTTP servers and returns them for management.
-func startServers(conf *common.Config, l *slog.Logger) []*http.Server {
-	startingPort := conf.StartingPort
-	n := conf.NumOfServers
+func startServers(conf *common.Config, sockets *listenerSet, l *slog.Logger) []*http.Server {
+	startingPort := conf.DemoServers.StartingPort
+	n := conf.DemoServers.Count
 
 	servers := make([]*http.Server, 0, n)
 
@@ -71,8 +158,14 @@ func startServers(conf *common.Config, l *slog.Logger) []*http.Server {
 
 		servers = append(servers, server)
 
+		ln, err := sockets.Listen("tcp", server.Addr)
+		if err != nil {
+			l.Error("failed to start the server", "err", err)
+			os.Exit(1)
+		}
+
 		go func(s *http.Server) {
-			if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			if err := s.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
 				l.Error("failed to start the server", "err", err)
 				os.Exit(1)
 			}
@@ -83,45 +176,3 @@ func startServers(conf *common.Config, l *slog.Logger) []*http.Server {
 
 	return servers
 }
-
-func startLoadBalancer(conf *common.Config, l *slog.Logger) {
-	loadBalancerPort := conf.LoadBalancerPort
-	startingPort := conf.StartingPort
-	srvCnt := conf.NumOfServers
-
-	lc := domain.LeastConnection{}
-	serverPool := domain.NewServerPool(&lc, srvCnt, l)
-
-	for i := 0; i < srvCnt; i++ {
-		port := startingPort + i
-		serverURL := fmt.Sprintf("http://localhost:%d", port)
-		srv, err := domain.NewServer(serverURL)
-
-		if err != nil {
-			l.Error("error creating server instances", "url", serverURL, "err", err)
-		}
-
-		if err := serverPool.AddServer(srv); err != nil {
-			return
-		}
-	}
-
-	// Setup and start the load balancer HTTP server.
-	handler := transport.ProxyRequestHandler(serverPool, l)
-	http.HandleFunc("/", handler)
-
-	// Create a custom http.Server with timeouts
-	s := &http.Server{
-		Addr:         net.JoinHostPort(conf.APIHost, loadBalancerPort),
-		Handler:      handler,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  15 * time.Second,
-	}
-
-	l.Info("Load balancer listening at", "addr", s.Addr)
-
-	if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		l.Error("failed to start load balancer", "err", err)
-	}
-}
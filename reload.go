@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/ashtishad/golift/internal/common"
+	"github.com/ashtishad/golift/internal/domain"
+)
+
+// reloadConfig re-reads the config file and applies it. A failed reload is logged with its reason
+// and leaves the previous configuration active.
+func (b *balancer) reloadConfig(path string) {
+	if path == "" {
+		b.l.Warn("config reload requested, but no config file is used")
+		return
+	}
+
+	conf, err := common.LoadConfig(path, b.l)
+	if err == nil {
+		err = b.reload(conf)
+	}
+
+	if err != nil {
+		b.l.Error("config reload failed, keeping previous configuration", "path", path, "err", err)
+		return
+	}
+
+	b.l.Info("config reloaded", "path", path)
+}
+
+// reload diffs conf against the running state and applies it: backends are added to and removed from
+// the running pools, strategies, health checks and outlier detection are replaced where they changed,
+// listeners are started or shut down, and a changed log level is applied. Requests in flight complete on the servers they were sent to.
+//
+// Everything that can fail, building strategies and servers, creating new pools and binding new
+// listeners, happens before the first change is applied, so a failed reload changes nothing.
+func (b *balancer) reload(conf *common.Config) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.stopping {
+		return errors.New("load balancer is shutting down")
+	}
+
+	current := b.state.Load()
+
+	if !reflect.DeepEqual(current.conf.DemoServers, conf.DemoServers) {
+		b.l.Warn("changes of demoServers are ignored until the next restart")
+	}
+
+	if current.conf.Log.Format != conf.Log.Format || current.conf.Log.Source != conf.Log.Source {
+		b.l.Warn("changes of log.format and log.source are ignored until the next restart")
+	}
+
+	if current.conf.RequestID != conf.RequestID {
+		b.l.Warn("changes of requestId are ignored until the next restart")
+	}
+
+	if current.conf.Tracing != conf.Tracing {
+		b.l.Warn("changes of tracing are ignored until the next restart")
+	}
+
+	if current.conf.AccessLog != conf.AccessLog {
+		b.l.Warn("changes of accessLog are ignored until the next restart")
+	}
+
+	pools := make(map[string]*pool, len(conf.Pools))
+
+	var (
+		apply []func()
+		errs  []error
+	)
+
+	for i, pc := range conf.Pools {
+		l := b.l.With("pool", pc.Name)
+
+		running, exists := current.pools[pc.Name]
+		if !exists {
+			p, err := newPool(pc, b.metrics.Pool(pc.Name), b.tracer, l)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("pools[%d]%w", i, err))
+				continue
+			}
+
+			pools[pc.Name] = p
+			apply = append(apply, func() { p.healthChecker.Start(b.ctx) })
+
+			continue
+		}
+
+		p, changes, err := updatePool(b.ctx, running, pc, conf.Shutdown.Timeout.Duration, l)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pools[%d]%w", i, err))
+			continue
+		}
+
+		pools[pc.Name] = p
+		apply = append(apply, changes...)
+	}
+
+	// A level changed at runtime via the admin API is kept until the configured level changes.
+	if current.conf.Log.Level != conf.Log.Level {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(conf.Log.Level)); err != nil {
+			errs = append(errs, fmt.Errorf("log.level: %w", err))
+		} else {
+			apply = append(apply, func() { b.logLevel.Set(level) })
+		}
+	}
+
+	for name, p := range current.pools {
+		if _, exists := pools[name]; !exists {
+			apply = append(apply, p.stop)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	bound, admin, err := b.bindListeners(conf)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range apply {
+		change()
+	}
+
+	b.state.Store(newBalancerState(conf, pools))
+	b.serveListeners(conf, bound, admin)
+
+	return nil
+}
+
+// updatePool prepares the changes turning the running pool into the one described by pc. Removed backends
+// are drained for up to drainTimeout. It returns the updated pool and the changes to apply, or an error
+// prefixed with the path of the offending field.
+func updatePool(ctx context.Context, running *pool, pc common.PoolConfig, drainTimeout time.Duration, l *slog.Logger) (*pool, []func(), error) {
+	p := *running
+	p.conf = pc
+
+	var apply []func()
+
+	if !reflect.DeepEqual(running.conf.Strategy, pc.Strategy) {
+		strategy, err := domain.NewStrategy(pc.Strategy.Name, pc.Strategy.Options)
+		if err != nil {
+			return nil, nil, fmt.Errorf(".strategy: %w", err)
+		}
+
+		apply = append(apply, func() { p.serverPool.SetStrategy(ctx, pc.Strategy.Name, strategy) })
+	}
+
+	// Backends are matched by server id. Changed weights and health thresholds are applied to the running
+	// servers, so they keep their alive status and requests in flight.
+	thresholdsChanged := running.conf.HealthCheck.Rise != pc.HealthCheck.Rise ||
+		running.conf.HealthCheck.Fall != pc.HealthCheck.Fall ||
+		running.conf.HealthCheck.HoldDown != pc.HealthCheck.HoldDown
+
+	previous := make(map[string]common.BackendConfig, len(running.conf.Backends))
+	for _, bc := range running.conf.Backends {
+		if srvID, err := common.GenerateServerID(bc.URL); err == nil {
+			previous[srvID] = bc
+		}
+	}
+
+	configured := make(map[string]bool, len(pc.Backends))
+
+	for i, bc := range pc.Backends {
+		srvID, err := common.GenerateServerID(bc.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf(".backends[%d].url: %w", i, err)
+		}
+
+		if configured[srvID] {
+			return nil, nil, fmt.Errorf(".backends[%d].url: duplicate backend %q", i, bc.URL)
+		}
+
+		configured[srvID] = true
+
+		// Backends removed via the admin API since are added again, draining ones once the drain removed them.
+		existing, appErr := running.serverPool.GetServer(ctx, srvID)
+		if appErr == nil && !existing.IsDraining() {
+			if prev, exists := previous[srvID]; exists && prev.Weight != bc.Weight {
+				apply = append(apply, func() {
+					if appErr := p.serverPool.SetServerWeight(ctx, srvID, bc.Weight); appErr != nil {
+						l.Error("failed to change backend weight", "url", bc.URL, "err", appErr)
+					}
+				})
+			}
+
+			continue
+		}
+
+		srv, err := newServer(bc, pc.HealthCheck, l)
+		if err != nil {
+			return nil, nil, fmt.Errorf(".backends[%d].url: %w", i, err)
+		}
+
+		apply = append(apply, func() {
+			if appErr := p.serverPool.ReplaceDrainingServer(ctx, srv); appErr != nil {
+				l.Error("failed to add backend", "url", bc.URL, "err", appErr)
+			}
+		})
+	}
+
+	// Servers registered via the admin API get the thresholds of their pool as well.
+	if thresholdsChanged {
+		apply = append(apply, func() {
+			for _, srv := range p.serverPool.ListServers() {
+				srv.SetHealthThresholds(pc.HealthCheck.Rise, pc.HealthCheck.Fall, pc.HealthCheck.HoldDown.Duration)
+			}
+		})
+	}
+
+	for srvID := range previous {
+		if !configured[srvID] {
+			apply = append(apply, func() { _, _ = p.serverPool.DrainServer(ctx, srvID, drainTimeout) })
+		}
+	}
+
+	if !reflect.DeepEqual(probeSettings(running.conf.HealthCheck), probeSettings(pc.HealthCheck)) {
+		p.healthChecker = newHealthChecker(p.serverPool, pc.HealthCheck, p.metrics, l)
+
+		apply = append(apply, func() {
+			running.healthChecker.Stop()
+			p.serverPool.Unsubscribe(running.healthChecker)
+			p.healthChecker.Start(ctx)
+		})
+	}
+
+	if !reflect.DeepEqual(running.conf.OutlierDetection, pc.OutlierDetection) {
+		// The detector subscribes to the pool when created, so it is only created once the reload is applied.
+		apply = append(apply, func() {
+			p.serverPool.Unsubscribe(running.outlierDetector)
+			p.setOutlierDetector(newOutlierDetector(p.serverPool, pc.OutlierDetection, l), l)
+		})
+	}
+
+	return &p, apply, nil
+}
+
+// probeSettings returns hc without the thresholds, which are settings of the servers rather than the checker.
+func probeSettings(hc common.HealthCheckConfig) common.HealthCheckConfig {
+	hc.Rise, hc.Fall, hc.HoldDown = 0, 0, common.Duration{}
+	return hc
+}
+
+// watchConfig calls reload whenever the modification time or size of the file at path changes,
+// checking every interval until ctx is canceled.
+func watchConfig(ctx context.Context, path string, interval time.Duration, reload func()) {
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+
+		return info.ModTime(), info.Size()
+	}
+
+	modTime, size := stat()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if m, s := stat(); s >= 0 && (!m.Equal(modTime) || s != size) {
+			modTime, size = m, s
+			reload()
+		}
+	}
+}
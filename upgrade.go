@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// listenerSet opens the listening sockets of the process. It reuses the sockets inherited from
+// the parent process on upgrade, and hands every open socket to the child on the next upgrade.
+type listenerSet struct {
+	mux       sync.Mutex
+	inherited map[string]net.Listener // Inherited sockets not claimed by Listen yet, keyed by address.
+	opened    map[string]*net.TCPListener
+	upgrading atomic.Bool // Set while a child started by upgrade runs, so a second upgrade is refused.
+}
+
+func newListenerSet() *listenerSet {
+	return &listenerSet{
+		inherited: make(map[string]net.Listener),
+		opened:    make(map[string]*net.TCPListener),
+	}
+}
+
+// Listen returns the inherited socket for addr if there is one, or opens a new one.
+func (ls *listenerSet) Listen(network, addr string) (net.Listener, error) {
+	ls.mux.Lock()
+	defer ls.mux.Unlock()
+
+	ln, inherited := ls.inherited[addr]
+	if inherited {
+		delete(ls.inherited, addr)
+	} else {
+		var err error
+		if ln, err = net.Listen(network, addr); err != nil {
+			return nil, err
+		}
+	}
+
+	if tcp, ok := ln.(*net.TCPListener); ok {
+		ls.opened[addr] = tcp
+	}
+
+	return ln, nil
+}
+
+// closeUnused closes the inherited sockets whose address is no longer configured.
+func (ls *listenerSet) closeUnused(l *slog.Logger) {
+	ls.mux.Lock()
+	defer ls.mux.Unlock()
+
+	for addr, ln := range ls.inherited {
+		l.Info("closing inherited listener that is no longer configured", "addr", addr)
+		_ = ln.Close()
+		delete(ls.inherited, addr)
+	}
+}
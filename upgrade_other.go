@@ -0,0 +1,26 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"runtime"
+)
+
+// upgradeSignals is empty, upgrades pass listening sockets as inherited file descriptors, which needs unix.
+var upgradeSignals []os.Signal
+
+// inheritListeners returns an empty listener set, processes are never started by an upgrade.
+func inheritListeners() (*listenerSet, int, error) {
+	return newListenerSet(), 0, nil
+}
+
+// upgrade is not supported on this platform.
+func upgrade(*listenerSet, *slog.Logger) error {
+	return errors.New("upgrades are not supported on " + runtime.GOOS)
+}
+
+// notifyParent does nothing, as there is never a parent to notify.
+func notifyParent(int, *slog.Logger) {}
@@ -0,0 +1,196 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// upgradeSignals upgrade the process to the executable currently on disk, see upgrade.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
+
+// listenFDsEnv names the addresses of the listener file descriptors a process inherits from its parent
+// on upgrade, comma separated in the order of the descriptors starting at 3.
+const listenFDsEnv = "GOLIFT_LISTEN_FDS"
+
+// parentPIDEnv holds the pid of the process that started this one on upgrade, the only process it may
+// ask to shut down.
+const parentPIDEnv = "GOLIFT_PARENT_PID"
+
+// inheritListeners returns the listener set of the process, holding the sockets passed by the parent
+// if the process was started by an upgrade. The second result is the pid of that parent, 0 if none.
+func inheritListeners() (*listenerSet, int, error) {
+	ls := newListenerSet()
+
+	names := os.Getenv(listenFDsEnv)
+	if names == "" {
+		return ls, 0, nil
+	}
+
+	// Children of this process get their own list and parent pid.
+	_ = os.Unsetenv(listenFDsEnv)
+
+	rawPID := os.Getenv(parentPIDEnv)
+	_ = os.Unsetenv(parentPIDEnv)
+
+	parentPID, err := strconv.Atoi(rawPID)
+	if err != nil || parentPID <= 1 {
+		return nil, 0, fmt.Errorf("%s: invalid parent pid %q", parentPIDEnv, rawPID)
+	}
+
+	addrs := strings.Split(names, ",")
+
+	files := make([]*os.File, 0, len(addrs))
+	for i, addr := range addrs {
+		files = append(files, os.NewFile(uintptr(3+i), addr))
+	}
+
+	if err := ls.inherit(addrs, files); err != nil {
+		return nil, parentPID, err
+	}
+
+	return ls, parentPID, nil
+}
+
+// inherit adopts the listening sockets in files, addrs[i] is the configured address of files[i].
+// The files are closed, the listeners keep their own descriptors.
+func (ls *listenerSet) inherit(addrs []string, files []*os.File) error {
+	var errs []error
+
+	for i, f := range files {
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("inherited listener %s: %w", addrs[i], err))
+			continue
+		}
+
+		ls.inherited[addrs[i]] = ln
+	}
+
+	return errors.Join(errs...)
+}
+
+// files duplicates the descriptors of every socket still open, for a child process to inherit.
+// The caller closes the returned files once the child has started.
+func (ls *listenerSet) files() ([]string, []*os.File, error) {
+	ls.mux.Lock()
+	defer ls.mux.Unlock()
+
+	var (
+		addrs []string
+		files []*os.File
+	)
+
+	for addr, ln := range ls.opened {
+		f, err := ln.File()
+		if errors.Is(err, net.ErrClosed) {
+			delete(ls.opened, addr) // Shut down by a reload.
+			continue
+		}
+
+		if err != nil {
+			closeFiles(files)
+			return nil, nil, fmt.Errorf("listener %s: %w", addr, err)
+		}
+
+		addrs = append(addrs, addr)
+		files = append(files, f)
+	}
+
+	return addrs, files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+// upgrade starts a new process of the current executable with the same arguments, which inherits every
+// listening socket and so accepts connections on them without the sockets ever being closed. Once the
+// child is serving it asks this process to shut down gracefully with SIGTERM, see notifyParent.
+// If the child fails to start, this process keeps serving. Another upgrade is refused until the child exited.
+func upgrade(ls *listenerSet, l *slog.Logger) error {
+	if !ls.upgrading.CompareAndSwap(false, true) {
+		return errors.New("an upgrade is already in progress")
+	}
+
+	cmd, addrs, err := startChild(ls)
+	if err != nil {
+		ls.upgrading.Store(false)
+		return err
+	}
+
+	l.Info("started upgraded process, handing over listeners", "pid", cmd.Process.Pid, "listeners", addrs)
+
+	go func() {
+		// Only returns while this process still runs if the child failed.
+		if err := cmd.Wait(); err != nil {
+			l.Error("upgraded process exited, keeping this process serving", "pid", cmd.Process.Pid, "err", err)
+		}
+
+		ls.upgrading.Store(false)
+	}()
+
+	return nil
+}
+
+// startChild starts the current executable with the same arguments, passing it every socket of ls
+// and the pid of this process. It returns the started child and the addresses of the passed sockets.
+func startChild(ls *listenerSet) (*exec.Cmd, []string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to locate executable: %w", err)
+	}
+
+	addrs, files, err := ls.files()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeFiles(files)
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, listenFDsEnv+"=") && !strings.HasPrefix(kv, parentPIDEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(env, listenFDsEnv+"="+strings.Join(addrs, ","), parentPIDEnv+"="+strconv.Itoa(os.Getpid()))
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("unable to start %s: %w", exe, err)
+	}
+
+	return cmd, addrs, nil
+}
+
+// notifyParent asks the process this one was upgraded from, ppid, to drain and exit, now that this process
+// accepts connections on the inherited sockets. Nothing is signaled unless ppid is still the parent of this
+// process, so a stale pid never hits an unrelated process.
+func notifyParent(ppid int, l *slog.Logger) {
+	if os.Getppid() != ppid {
+		l.Warn("upgrade complete, but the parent process is gone", "pid", ppid)
+		return
+	}
+
+	if err := syscall.Kill(ppid, syscall.SIGTERM); err != nil {
+		l.Error("failed to notify parent process of the upgrade", "pid", ppid, "err", err)
+		return
+	}
+
+	l.Info("upgrade complete, parent process is draining", "pid", ppid)
+}
@@ -0,0 +1,123 @@
+//go:build unix
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestListenerSet_Handoff tests that a socket handed to another listener set keeps accepting
+// connections on the same address after the original listener closed.
+func TestListenerSet_Handoff(t *testing.T) {
+	parent := newListenerSet()
+
+	ln, err := parent.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	addr := ln.Addr().String()
+
+	addrs, files, err := parent.files()
+	if err != nil {
+		t.Fatalf("failed to duplicate listeners: %v", err)
+	}
+
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1:0" {
+		t.Fatalf("expected the configured address to be handed over, got %v", addrs)
+	}
+
+	child := newListenerSet()
+	if err := child.inherit(addrs, files); err != nil {
+		t.Fatalf("failed to inherit listeners: %v", err)
+	}
+
+	// The parent stops accepting, the socket stays open through the child's descriptor.
+	ln.Close()
+
+	inherited, err := child.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to claim inherited listener: %v", err)
+	}
+
+	if got := inherited.Addr().String(); got != addr {
+		t.Fatalf("expected inherited listener on %s, got %s", addr, got)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), ReadHeaderTimeout: time.Second}
+	go func() { _ = srv.Serve(inherited) }()
+	t.Cleanup(func() { srv.Close() })
+
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("expected the child to accept on %s: %v", addr, err)
+	}
+	resp.Body.Close()
+
+	if addrs, files, err := parent.files(); err != nil || len(addrs) != 0 {
+		closeFiles(files)
+		t.Errorf("expected closed listeners not to be handed over, got %v, %v", addrs, err)
+	}
+}
+
+// TestListenerSet_CloseUnused tests that inherited sockets no longer configured are closed.
+func TestListenerSet_CloseUnused(t *testing.T) {
+	parent := newListenerSet()
+
+	for _, addr := range []string{"127.0.0.1:0", "[::1]:0"} {
+		ln, err := parent.Listen("tcp", addr)
+		if err != nil {
+			t.Skipf("unable to listen on %s: %v", addr, err)
+		}
+		defer ln.Close()
+	}
+
+	addrs, files, err := parent.files()
+	if err != nil {
+		t.Fatalf("failed to duplicate listeners: %v", err)
+	}
+
+	child := newListenerSet()
+	if err := child.inherit(addrs, files); err != nil {
+		t.Fatalf("failed to inherit listeners: %v", err)
+	}
+
+	unused := child.inherited["[::1]:0"]
+
+	if _, err := child.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatalf("failed to claim inherited listener: %v", err)
+	}
+
+	child.closeUnused(discardLogger())
+
+	if len(child.inherited) != 0 {
+		t.Errorf("expected no inherited listeners left, got %d", len(child.inherited))
+	}
+
+	if _, err := unused.Accept(); err == nil {
+		t.Errorf("expected unused inherited listener to be closed")
+	}
+}
+
+// TestUpgrade_InProgress tests that an upgrade is refused while the child of a previous one runs.
+func TestUpgrade_InProgress(t *testing.T) {
+	ls := newListenerSet()
+	ls.upgrading.Store(true)
+
+	if err := upgrade(ls, discardLogger()); err == nil {
+		t.Fatalf("expected a second upgrade to be refused")
+	}
+
+	if !ls.upgrading.Load() {
+		t.Errorf("expected the running upgrade to stay in progress")
+	}
+}
+
+// TestNotifyParent_OtherProcess tests that a pid other than the parent's is never signaled.
+func TestNotifyParent_OtherProcess(t *testing.T) {
+	// Signaling this process would terminate the test.
+	notifyParent(os.Getpid(), discardLogger())
+}
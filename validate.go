@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/ashtishad/golift/internal/common"
+	"gopkg.in/yaml.v3"
+)
+
+// runValidate implements "golift validate": it loads the config file exactly like the load balancer does,
+// builds every pool and strategy without probing backends or binding ports, and prints the effective
+// configuration with defaults and environment overrides applied. It returns the process exit code.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "path to a YAML or JSON config file, built-in defaults if empty")
+	quiet := fs.Bool("q", false, "only report problems, do not print the effective configuration")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments: %v\n", fs.Args())
+		fs.Usage()
+
+		return 2
+	}
+
+	// Only warnings are of interest here, e.g. ignored environment variables.
+	l := slog.New(slog.NewTextHandler(stderr, common.GetSlogConf(slog.LevelWarn, false)))
+
+	conf, err := common.LoadConfig(*configPath, l)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// Building the balancer resolves strategy names and options, nothing is started.
+	if _, err := newBalancer(conf, new(slog.LevelVar), l); err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+
+	if *quiet {
+		return 0
+	}
+
+	enc := yaml.NewEncoder(stdout)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(conf); err != nil {
+		fmt.Fprintf(stderr, "unable to print configuration: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "golift.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	return path
+}
+
+// TestRunValidate tests that valid files print the effective configuration and semantic
+// problems are reported with the path of the offending field.
+func TestRunValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantCode int
+		want     []string
+	}{
+		{
+			name: "Valid",
+			content: `
+listeners:
+  - {name: public, address: "127.0.0.1:8080", pool: web}
+pools:
+  - name: web
+    strategy: {name: p2c}
+    backends:
+      - url: http://10.0.0.1:8000
+`,
+			wantCode: 0,
+			want:     []string{"name: p2c", "interval: 5s", "weight: 1"},
+		},
+		{
+			name: "Semantic Errors",
+			content: `
+listeners:
+  - {name: public, address: "127.0.0.1:8080", pool: web}
+  - {name: internal, address: "0.0.0.0:8080", pool: web}
+admin:
+  address: "127.0.0.1:8001"
+demoServers: {count: 2, startingPort: 8000}
+pools:
+  - name: web
+    outlierDetection: {baseEjectionTime: 1m, maxEjectionTime: 30s}
+    backends:
+      - url: http://10.0.0.1:8000
+      - url: http://10.0.0.1:8000/api
+`,
+			wantCode: 1,
+			want: []string{
+				"listeners[1].address: port 8080 conflicts with listeners[0].address",
+				"demoServers[1]: port 8001 conflicts with admin.address",
+				`pools[0].backends[1].url: duplicate backend "http://10.0.0.1:8000/api", same server as backends[0]`,
+				"pools[0].outlierDetection.maxEjectionTime: must not be less than baseEjectionTime 1m0s, got 30s",
+			},
+		},
+		{
+			name: "Unknown Strategy",
+			content: `
+listeners:
+  - {name: public, address: "127.0.0.1:8080", pool: web}
+pools:
+  - name: web
+    strategy: {name: fastest}
+`,
+			wantCode: 1,
+			want:     []string{`pools[0].strategy: unknown strategy "fastest"`},
+		},
+		{
+			name: "Access Log Template",
+			content: `
+listeners:
+  - {name: public, address: "127.0.0.1:8080", pool: web}
+accessLog: {output: stdout, format: template, template: "{{.Host}}"}
+pools:
+  - name: web
+`,
+			wantCode: 1,
+			want:     []string{"accessLog.template:", "can't evaluate field Host"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			code := runValidate([]string{"-config", writeConfig(t, tt.content)}, &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("expected exit code %d, got %d, stderr:\n%s", tt.wantCode, code, stderr.String())
+			}
+
+			out := stdout.String() + stderr.String()
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, out)
+				}
+			}
+		})
+	}
+}